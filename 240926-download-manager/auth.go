@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxAuthResponseSize caps how much of the -auth-request response is read.
+const maxAuthResponseSize = 1 << 20
+
+// authRequest is a preliminary API call whose JSON response holds the URL to
+// download, as with presigned-URL APIs: POST a JSON body, get back a
+// short-lived signed link, GET that.
+type authRequest struct {
+	Method  string
+	URL     string
+	Body    string // the body itself, or @file to read it from a file
+	Headers http.Header
+	// URLPath is a JSONPath like $.data.url selecting the download URL
+	URLPath string
+}
+
+// addAuthFlags defines the -auth-* flags on fs, filling in a.
+func addAuthFlags(fs *flag.FlagSet, a *authRequest) {
+	a.Headers = http.Header{}
+	fs.Func("auth-request", "Ask this API for the download URL first: \"[METHOD] URL\" (default POST with -auth-body, else GET)", func(s string) error {
+		method, rawURL, ok := strings.Cut(strings.TrimSpace(s), " ")
+		if !ok {
+			method, rawURL = "", method
+		}
+		a.Method, a.URL = strings.ToUpper(method), strings.TrimSpace(rawURL)
+		return nil
+	})
+	fs.StringVar(&a.Body, "auth-body", "", "Body of the -auth-request, or @file to read it from a file")
+	fs.Var(headerFlag(a.Headers), "auth-header", "Header \"Key: Value\" for the -auth-request only (repeatable)")
+	fs.StringVar(&a.URLPath, "auth-url-path", "$.url", "JSONPath of the download URL in the -auth-request response")
+}
+
+// resolveAuthURL makes the -auth-request and returns the download URL found
+// at a.URLPath in its JSON response. opts supplies the proxy, TLS and log
+// settings; opts.Headers are not sent, the API gets a.Headers instead.
+func resolveAuthURL(ctx context.Context, a authRequest, opts options) (string, error) {
+	body := []byte(a.Body)
+	if name, ok := strings.CutPrefix(a.Body, "@"); ok {
+		var err error
+		if body, err = os.ReadFile(name); err != nil {
+			return "", fmt.Errorf("reading -auth-body: %w", err)
+		}
+	}
+	method := a.Method
+	if method == "" {
+		method = http.MethodGet
+		if len(body) > 0 {
+			method = http.MethodPost
+		}
+	}
+
+	log := opts.Log
+	if log == nil {
+		log = nopLogger
+	}
+	client, err := newClient(opts)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("creating auth request: %w", err)
+	}
+	req.Header = a.Headers.Clone()
+	if len(body) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		log.Error("auth", "method", method, "url", a.URL, "error", err.Error())
+		return "", fmt.Errorf("auth request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		log.Error("auth", "method", method, "url", a.URL, "status", res.StatusCode)
+		return "", fmt.Errorf("auth request: %s", res.Status)
+	}
+
+	var doc any
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxAuthResponseSize)).Decode(&doc); err != nil {
+		return "", fmt.Errorf("auth response is not JSON: %w", err)
+	}
+	value, err := lookupJSONPath(doc, a.URLPath)
+	if err != nil {
+		return "", fmt.Errorf("auth response: %w", err)
+	}
+	downloadURL, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("auth response: %s is not a string", a.URLPath)
+	}
+	// Only fetch what the API hands out over HTTP, never a local file
+	if u, err := url.Parse(downloadURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("auth response: %s is not an http or https URL: %q", a.URLPath, redactURL(downloadURL))
+	}
+	log.Info("auth", "method", method, "url", a.URL, "status", res.StatusCode, "download_url", redactURL(downloadURL))
+	return downloadURL, nil
+}
+
+// lookupJSONPath returns the value at path in doc, a decoded JSON document.
+// Only the plain subset of JSONPath is supported: $ followed by .key and
+// [index] steps, e.g. $.data.urls[0].href.
+func lookupJSONPath(doc any, path string) (any, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath %q must start with $", path)
+	}
+	value := doc
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			key := rest[1:end]
+			obj, ok := value.(map[string]any)
+			if key == "" || !ok {
+				return nil, fmt.Errorf("%s: no object key %q", path, key)
+			}
+			if value, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("%s: no key %q in the response", path, key)
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q has an unclosed [", path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			arr, ok := value.([]any)
+			if err != nil || !ok || i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("%s: no array element %s", path, rest[:end+1])
+			}
+			value = arr[i]
+			rest = rest[end+1:]
+		default:
+			return nil, errors.New("JSONPath " + strconv.Quote(path) + " is not of the form $.key[0].key")
+		}
+	}
+	return value, nil
+}
+
+// redactURL drops the query and credentials of a URL for logging.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
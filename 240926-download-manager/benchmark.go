@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// BenchmarkResult is the speed measured for one URL.
+type BenchmarkResult struct {
+	URL        string  `json:"url"`
+	Bytes      int64   `json:"bytes"`
+	TTFB       float64 `json:"ttfb_seconds"`
+	Total      float64 `json:"total_seconds"`
+	Throughput float64 `json:"throughput_bytes_per_second"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// runBenchmark downloads each of opts.URLs into nothing, stopping after
+// maxBytes or maxTime when they are set, and prints the URLs ranked by
+// throughput. It returns the exit code: 0 when at least one URL could be
+// measured.
+func runBenchmark(ctx context.Context, opts options, maxBytes int64, maxTime time.Duration, jsonOut bool) int {
+	var results []BenchmarkResult
+	for _, url := range opts.URLs {
+		r := benchmark(ctx, url, opts, maxBytes, maxTime)
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Interrupted")
+			return exitInterrupted
+		}
+		if r.Error != "" && !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "Error %s: %s\n", url, r.Error)
+		}
+		results = append(results, r)
+	}
+
+	// Fastest first, failed URLs last
+	slices.SortStableFunc(results, func(a, b BenchmarkResult) int {
+		if (a.Error == "") != (b.Error == "") {
+			if a.Error == "" {
+				return -1
+			}
+			return 1
+		}
+		switch {
+		case a.Throughput > b.Throughput:
+			return -1
+		case a.Throughput < b.Throughput:
+			return 1
+		}
+		return 0
+	})
+
+	if jsonOut {
+		json.NewEncoder(os.Stdout).Encode(results)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RANK\tSPEED\tTTFB\tTIME\tBYTES\tURL")
+		for i, r := range results {
+			if r.Error != "" {
+				fmt.Fprintf(w, "-\tfailed\t\t\t\t%s\n", r.URL)
+				continue
+			}
+			fmt.Fprintf(w, "%d\t%s/s\t%dms\t%.2fs\t%s\t%s\n", i+1, humanBytes(int64(r.Throughput)),
+				time.Duration(r.TTFB*float64(time.Second)).Milliseconds(), r.Total, humanBytes(r.Bytes), r.URL)
+		}
+		w.Flush()
+	}
+
+	if len(results) > 0 && results[0].Error == "" {
+		return 0
+	}
+	return exitFailure
+}
+
+// benchmark measures one URL. Reaching maxBytes or maxTime ends the
+// measurement normally, it isn't an error.
+func benchmark(ctx context.Context, url string, opts options, maxBytes int64, maxTime time.Duration) BenchmarkResult {
+	result := BenchmarkResult{URL: url}
+	client, err := clientFor(url, opts)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	var firstByte time.Time
+	reqCtx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	if maxTime > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(reqCtx, maxTime)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header = opts.Headers.Clone()
+	res, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		result.Error = res.Status
+		return result
+	}
+
+	var body io.Reader = res.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes)
+	}
+	result.Bytes, err = io.CopyBuffer(io.Discard, body, make([]byte, opts.bufferSize()))
+	total := time.Since(start)
+	if err != nil && !(maxTime > 0 && errors.Is(reqCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil) {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Total = total.Seconds()
+	if !firstByte.IsZero() {
+		result.TTFB = firstByte.Sub(start).Seconds()
+	}
+	// Throughput is over the body only, so a slow first byte doesn't skew it
+	if body := total - firstByte.Sub(start); !firstByte.IsZero() && body > 0 {
+		result.Throughput = float64(result.Bytes) / body.Seconds()
+	}
+	return result
+}
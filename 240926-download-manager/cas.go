@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// casPath is where a file with the given sha256 lives in the cache.
+func casPath(dir, sum string) string {
+	return filepath.Join(dir, strings.ToLower(sum))
+}
+
+// casLookup links output to the cached copy of a file with the expected
+// checksum, if there is one. The cached file is hashed again first; a copy
+// that no longer matches is dropped so it gets downloaded afresh.
+func casLookup(dir, sum, output string) (bool, error) {
+	cached := casPath(dir, sum)
+	hash := sha256.New()
+	if err := hashFile(hash, cached); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("reading cache: %w", err)
+	}
+	if !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), sum) {
+		os.Remove(cached)
+		return false, nil
+	}
+	return true, casLink(cached, output)
+}
+
+// casStore moves a downloaded output into the cache under its sha256 and
+// leaves a symlink in its place. When the cache already has the file the
+// download is simply dropped.
+func casStore(dir, sum, output string, logOut io.Writer) error {
+	cached := casPath(dir, sum)
+	if _, err := os.Stat(cached); err == nil {
+		os.Remove(output)
+	} else if err := os.Rename(output, cached); err != nil {
+		return fmt.Errorf("moving file into cache: %w", err)
+	}
+	fmt.Fprintln(logOut, "Stored in cache as", cached)
+	return casLink(cached, output)
+}
+
+// casLink makes output a symlink to the cached file, replacing whatever was
+// at output.
+func casLink(cached, output string) error {
+	target, err := filepath.Abs(cached)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(output); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(target, output)
+}
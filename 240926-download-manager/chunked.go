@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateSaveInterval is how often the chunk progress is written to disk.
+const stateSaveInterval = time.Second
+
+// fetchChunked downloads url over several connections at once, each one
+// fetching a byte range straight into its place in output.part. The chunk
+// progress is kept in output.part.json, so after an interruption only the
+// unfinished chunks are fetched again, as long as the server still has the
+// same file (same ETag or Last-Modified, same size).
+func fetchChunked(ctx context.Context, url string, probe ProbeResult, output string, logOut io.Writer, opts options) (DownloadResult, error) {
+	start := time.Now()
+	result := DownloadResult{FinalURL: probe.URL, Protocol: probe.Protocol}
+	state := chunkedState(output, url, probe, opts.Connections)
+	client, err := clientFor(url, opts)
+	if err != nil {
+		return result, err
+	}
+
+	var resumed int64
+	for _, c := range state.Chunks {
+		resumed += c.Done
+	}
+	if resumed > 0 {
+		fmt.Fprintf(logOut, "Resuming %d of %d bytes already downloaded\n", resumed, state.Size)
+		opts.Log.Info("resume", "url", redactURL(url), "offset", resumed)
+	} else if free, ok := freeSpace(filepath.Dir(output)); ok && free < uint64(state.Size)+diskSpaceMargin {
+		return result, fmt.Errorf("not enough disk space: need %d bytes, %d available", state.Size, free)
+	}
+
+	file, err := os.OpenFile(partPath(output), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return result, fmt.Errorf("creating file: %w", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(state.Size); err != nil {
+		return result, fmt.Errorf("creating file: %w", err)
+	}
+	if err := saveResume(output, state); err != nil {
+		return result, fmt.Errorf("saving resume state: %w", err)
+	}
+
+	progress, stopProgress := startProgress(opts.progressOut(logOut), resumed, state.Size, opts.retry, opts.Metrics)
+
+	// Save the chunk progress now and then while the workers run
+	var mu sync.Mutex
+	saveState := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return saveResume(output, state)
+	}
+	stopSaving := make(chan struct{})
+	savingDone := make(chan struct{})
+	go func() {
+		defer close(savingDone)
+		ticker := time.NewTicker(stateSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				saveState()
+			case <-stopSaving:
+				return
+			}
+		}
+	}()
+
+	// One failed chunk stops the others
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(state.Chunks))
+	for i := range state.Chunks {
+		if state.Chunks[i].complete() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fetchChunk(chunkCtx, client, url, state.validator(), file, &state.Chunks[i], &mu, io.MultiWriter(progress, opts.stall), opts)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	stopProgress()
+	close(stopSaving)
+	<-savingDone
+	saveState()
+
+	for _, c := range state.Chunks {
+		result.BytesWritten += c.Done
+	}
+	result.BytesWritten -= resumed
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	// Leave out the chunks that were only stopped because another one failed
+	var failed []error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			failed = append(failed, err)
+		}
+	}
+	if err := errors.Join(failed...); err != nil {
+		return result, fmt.Errorf("downloading chunks: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return result, fmt.Errorf("writing file: %w", err)
+	}
+
+	// The chunks arrive out of order, so the checksum is taken at the end
+	hash := hashAlgos[opts.HashAlgo]()
+	if err := hashFile(hash, partPath(output)); err != nil {
+		return result, fmt.Errorf("reading file: %w", err)
+	}
+	result.Algorithm = opts.HashAlgo
+	result.Checksum = hex.EncodeToString(hash.Sum(nil))
+	result.Duration = time.Since(start)
+
+	if err := checkMagic(partPath(output), output); err != nil {
+		clearResume(output)
+		return result, err
+	}
+
+	if opts.Checksum != "" {
+		logChecksum(opts.Log, opts.HashAlgo, opts.Checksum, result.Checksum, strings.EqualFold(result.Checksum, opts.Checksum))
+		if !strings.EqualFold(result.Checksum, opts.Checksum) {
+			clearResume(output)
+			if resumed > 0 {
+				return result, errResumeMismatch
+			}
+			return result, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, opts.Checksum, result.Checksum)
+		}
+		fmt.Fprintln(logOut, "Checksum verified")
+	}
+
+	if err := os.Rename(partPath(output), output); err != nil {
+		return result, fmt.Errorf("saving file: %w", err)
+	}
+	os.Remove(statePath(output))
+	saveETag(output, probe.ETag)
+	if !opts.NoPreserveTime {
+		preserveTime(output, probe.LastModified)
+	}
+
+	fmt.Fprintln(logOut, paint(logOut, opts.NoColor, colorGreen, "File downloaded successfully"))
+	return result, nil
+}
+
+// chunkedState returns the saved chunk state for output if it belongs to the
+// same file as probe, or a fresh split into n chunks otherwise.
+func chunkedState(output, url string, probe ProbeResult, n int) resumeState {
+	var saved resumeState
+	if data, err := os.ReadFile(statePath(output)); err == nil && json.Unmarshal(data, &saved) == nil {
+		fresh := resumeState{ETag: probe.ETag, LastModified: probe.LastModified}
+		if len(saved.Chunks) > 0 && saved.Size == probe.ContentLength &&
+			saved.validator() != "" && saved.validator() == fresh.validator() {
+			return saved
+		}
+	}
+
+	state := resumeState{
+		URL:          url,
+		ETag:         probe.ETag,
+		LastModified: probe.LastModified,
+		Size:         probe.ContentLength,
+	}
+	chunkSize := (probe.ContentLength + int64(n) - 1) / int64(n)
+	for start := int64(0); start < probe.ContentLength; start += chunkSize {
+		end := min(start+chunkSize, probe.ContentLength) - 1
+		state.Chunks = append(state.Chunks, chunkState{Start: start, End: end})
+	}
+	return state
+}
+
+// fetchChunk downloads the rest of chunk c and writes it at its offset in
+// file, updating c.Done under mu as the bytes land. Every byte is also
+// written to progress, for counting.
+func fetchChunk(ctx context.Context, client *http.Client, url, validator string, file *os.File, c *chunkState, mu *sync.Mutex, progress io.Writer, opts options) error {
+	mu.Lock()
+	from := c.Start + c.Done
+	mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = opts.Headers.Clone()
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, c.End))
+	req.Header.Set("Accept-Encoding", "identity")
+	if validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// A 200 means If-Range failed and the whole file is coming back
+	if res.StatusCode == http.StatusOK {
+		return fmt.Errorf("bytes %d-%d: %s (file changed on the server?)", from, c.End, res.Status)
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("bytes %d-%d: %s", from, c.End, res.Status)
+	}
+	if start, err := rangeStart(res.Header.Get("Content-Range")); err != nil || start != from {
+		return fmt.Errorf("bytes %d-%d: server sent the wrong range (%s)", from, c.End, res.Header.Get("Content-Range"))
+	}
+
+	// Never write past the chunk, whatever the server sends
+	body := io.LimitReader(res.Body, c.End-from+1)
+	buf := make([]byte, opts.bufferSize())
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := file.WriteAt(buf[:n], from); werr != nil {
+				return werr
+			}
+			from += int64(n)
+			mu.Lock()
+			c.Done += int64(n)
+			mu.Unlock()
+			progress.Write(buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if from <= c.End {
+		return fmt.Errorf("bytes %d-%d: connection closed early", from, c.End)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shafiqsaaidin/go-project/term"
+)
+
+const (
+	colorGreen = "\033[32m"
+	colorRed   = "\033[31m"
+	colorReset = "\033[0m"
+)
+
+// paint wraps s in the ANSI color when w is a terminal. Color is left out
+// when noColor is set or the NO_COLOR environment variable is not empty, see
+// https://no-color.org.
+func paint(w io.Writer, noColor bool, color, s string) string {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return s
+	}
+	if !term.IsTerminal(w) {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// printError reports a failed download on stderr, "Error" in red.
+func printError(opts options, err error) {
+	fmt.Fprintln(os.Stderr, paint(os.Stderr, opts.NoColor, colorRed, "Error"), err)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// The ETag of a finished download is kept in output.etag so the next run
+// can ask the server whether the file changed.
+func etagPath(output string) string { return output + ".etag" }
+
+// conditionalHeaders returns If-None-Match and If-Modified-Since headers for
+// an existing output file, or nil when there is no file yet.
+func conditionalHeaders(output string) http.Header {
+	info, err := os.Stat(output)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	h := http.Header{}
+	h.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	if etag, err := os.ReadFile(etagPath(output)); err == nil {
+		h.Set("If-None-Match", strings.TrimSpace(string(etag)))
+	}
+	return h
+}
+
+// unchangedSince reports whether the server's file described by probe is
+// the same one we already have in output. It is used for parallel
+// downloads, which start with a probe instead of a conditional GET.
+func unchangedSince(output string, probe ProbeResult) bool {
+	info, err := os.Stat(output)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if etag, err := os.ReadFile(etagPath(output)); err == nil && probe.ETag != "" {
+		return strings.TrimSpace(string(etag)) == probe.ETag
+	}
+	modified, err := http.ParseTime(probe.LastModified)
+	return err == nil && info.Size() == probe.ContentLength && !modified.After(info.ModTime().Truncate(time.Second))
+}
+
+// existingVerified reports whether output may be kept when the server says
+// it hasn't changed. With a checksum the file on disk has to match it, so a
+// copy damaged since the last run is downloaded again instead of being
+// reported up to date.
+func existingVerified(output string, opts options) bool {
+	if opts.Checksum == "" {
+		return true
+	}
+	h := hashAlgos[opts.HashAlgo]()
+	if err := hashFile(h, output); err != nil {
+		return false
+	}
+	return strings.EqualFold(hex.EncodeToString(h.Sum(nil)), opts.Checksum)
+}
+
+// saveETag remembers etag for output, or forgets an old one when the server
+// didn't send any.
+func saveETag(output, etag string) {
+	if etag == "" {
+		os.Remove(etagPath(output))
+		return
+	}
+	os.WriteFile(etagPath(output), []byte(etag+"\n"), 0644)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// applyConfig sets the flags of fs that weren't given on the command line
+// from the JSON object in the file name. The keys are flag names, e.g.
+//
+//	{"url": ["https://a/f.zip", "https://b/f.zip"], "output": "f.zip",
+//	 "header": {"Authorization": "Bearer ..."}, "sha256": "...", "retries": 3}
+//
+// A list sets a repeatable flag once per element and an object sets it once
+// per "key: value" pair. Keys that aren't flags are reported as errors.
+func applyConfig(fs *flag.FlagSet, name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var config map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	var keys, unknown []string
+	for key := range config {
+		if fs.Lookup(key) == nil || key == "config" {
+			unknown = append(unknown, key)
+		}
+		keys = append(keys, key)
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return fmt.Errorf("%s: unknown keys %s", name, strings.Join(unknown, ", "))
+	}
+	slices.Sort(keys)
+
+	// The command line wins over the file
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, key := range keys {
+		if given[key] {
+			continue
+		}
+		values, err := configValues(config[key])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", name, key, err)
+		}
+		for _, value := range values {
+			if err := fs.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %s: %w", name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues turns a JSON value into the flag values it stands for.
+func configValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case []any:
+		var values []string
+		for _, item := range v {
+			switch item.(type) {
+			case []any, map[string]any:
+				return nil, fmt.Errorf("nested lists and objects aren't supported")
+			}
+			more, err := configValues(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, more...)
+		}
+		return values, nil
+	case map[string]any:
+		var values []string
+		for key, item := range v {
+			value, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("value of %q must be a string", key)
+			}
+			values = append(values, key+": "+value)
+		}
+		slices.Sort(values)
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v", v)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// connLimit caps the number of requests in flight across every client of a
+// download: the probe, the chunk workers and each retry. A request holds a
+// slot from the moment it is sent until its body is closed. Waiting requests
+// get slots in the order they asked, so the chunks already running finish
+// before the ones queued behind them start.
+type connLimit chan struct{}
+
+// limitTransport makes every request through next wait for a slot in limit.
+type limitTransport struct {
+	next  http.RoundTripper
+	limit connLimit
+}
+
+func (t limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.limit <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		<-t.limit
+		return nil, err
+	}
+	res.Body = &releaseBody{ReadCloser: res.Body, release: sync.OnceFunc(func() { <-t.limit })}
+	return res, nil
+}
+
+// releaseBody gives the slot back when the body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConnections(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	var open, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := open.Add(1)
+		defer open.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	output := filepath.Join(t.TempDir(), "file.bin")
+	opts := testOptions(srv.URL+"/file.bin", output)
+	opts.Connections, opts.MaxConnections = 8, 2
+	if _, err := Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d requests at once, -max-connections is 2", p)
+	}
+	if data, _ := os.ReadFile(output); !bytes.Equal(data, content) {
+		t.Error("file doesn't match the server's copy")
+	}
+}
+
+// A resume that fails the checksum starts over; the first response must
+// have given its slot back by then or a single slot deadlocks.
+func TestMaxConnectionsRestart(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	output := filepath.Join(t.TempDir(), "file.bin")
+	corrupt := bytes.Clone(content[:len(content)/2])
+	copy(corrupt, "garbage")
+	if err := os.WriteFile(partPath(output), corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveResume(output, resumeState{URL: srv.URL, ETag: `"v1"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOptions(srv.URL+"/file.bin", output)
+	opts.Checksum = hex.EncodeToString(sum[:])
+	opts.MaxConnections, opts.TotalTimeout = 1, 5*time.Second
+	if _, err := Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(output); !bytes.Equal(data, content) {
+		t.Error("file doesn't match the server's copy")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strings"
+)
+
+// ErrUnexpectedContent is returned when the server sent something other
+// than the file asked for, typically an HTML error or login page.
+var ErrUnexpectedContent = errors.New("unexpected content")
+
+// checkContentType compares the media type of a Content-Type header with
+// the expected one, ignoring parameters such as charset.
+func checkContentType(contentType, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.EqualFold(mediaType, expected) {
+		return fmt.Errorf("%w: server sent Content-Type %q, expected %s", ErrUnexpectedContent, contentType, expected)
+	}
+	return nil
+}
+
+// fileMagic maps file name extensions to the bytes such files start with.
+var fileMagic = []struct {
+	ext   string
+	magic [][]byte
+}{
+	{".zip", [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}},
+	{".tar.gz", [][]byte{{0x1f, 0x8b}}},
+	{".tgz", [][]byte{{0x1f, 0x8b}}},
+	{".gz", [][]byte{{0x1f, 0x8b}}},
+	{".tar.xz", [][]byte{{0xfd, '7', 'z', 'X', 'Z', 0x00}}},
+	{".xz", [][]byte{{0xfd, '7', 'z', 'X', 'Z', 0x00}}},
+	{".tar.bz2", [][]byte{[]byte("BZh")}},
+	{".bz2", [][]byte{[]byte("BZh")}},
+	{".zst", [][]byte{{0x28, 0xb5, 0x2f, 0xfd}}},
+}
+
+// magicFor returns the extension of output found in fileMagic and the
+// bytes such files start with, or nil when it isn't one of them.
+func magicFor(output string) (string, [][]byte) {
+	for _, m := range fileMagic {
+		if strings.HasSuffix(strings.ToLower(output), m.ext) {
+			return m.ext, m.magic
+		}
+	}
+	return "", nil
+}
+
+// isCompressedName reports whether output is named like an archive or
+// compressed file. Such a file is saved exactly as the server sends it: a
+// .tar.gz served with Content-Encoding: gzip would otherwise be gunzipped
+// and saved as a plain tar under the .gz name.
+func isCompressedName(output string) bool {
+	_, magic := magicFor(output)
+	return magic != nil
+}
+
+// checkMagic makes sure the file at name starts the way files named like
+// output do, e.g. a .zip with "PK". Unknown extensions pass.
+func checkMagic(name, output string) error {
+	ext, want := magicFor(output)
+	if want == nil {
+		return nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	for _, magic := range want {
+		if bytes.HasPrefix(head, magic) {
+			return nil
+		}
+	}
+
+	hint := ""
+	if trimmed := bytes.ToLower(bytes.TrimSpace(head)); bytes.HasPrefix(trimmed, []byte("<!doctype html")) || bytes.HasPrefix(trimmed, []byte("<html")) {
+		hint = ", it looks like an HTML page"
+	}
+	return fmt.Errorf("%w: %s doesn't start like a %s file%s", ErrUnexpectedContent, output, ext, hint)
+}
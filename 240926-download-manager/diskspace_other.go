@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+// freeSpace is not supported on this platform, so the check is skipped.
+func freeSpace(dir string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// diskSpaceMargin is kept free on top of the file size when checking the disk
+const diskSpaceMargin = 10 << 20
+
+type options struct {
+	// URLs are tried in order until one of them succeeds
+	URLs    []string
+	Output  string
+	Headers http.Header
+
+	// Auth, when its URL is set, is asked for the URL to download first,
+	// replacing URLs
+	Auth authRequest
+
+	// Checksum is the expected hex digest of the file. HashAlgo is sha256,
+	// sha512, sha1 or md5; when empty it is guessed from the digest length.
+	// The weak sha1 and md5 are refused unless AllowWeakHash is set.
+	Checksum      string
+	HashAlgo      string
+	AllowWeakHash bool
+
+	MaxRedirects           int
+	AllowCrossHostRedirect bool
+
+	// Raw keeps a gzip/deflate encoded body as is instead of decoding it
+	Raw bool
+
+	// CACert is a PEM bundle trusted in addition to the system CAs
+	CACert string
+	// Insecure skips TLS certificate verification
+	Insecure bool
+
+	// MkdirAll creates the output directory when it doesn't exist
+	MkdirAll bool
+
+	// Proxy overrides the proxy from the environment (http, https or socks5)
+	Proxy string
+
+	// HTTP1 turns HTTP/2 off, for comparing the two
+	HTTP1 bool
+
+	// NoPreserveTime leaves the file's mtime alone instead of setting it to
+	// the server's Last-Modified
+	NoPreserveTime bool
+
+	// KeepPartial keeps the .part file of an interrupted download so the
+	// next run can resume it
+	KeepPartial bool
+
+	// Force downloads the file even when the local copy looks current
+	Force bool
+
+	// TrustPartHash continues the checksum of a resumed .part from the hash
+	// state saved with it even when a checksum is expected. Otherwise the
+	// .part is read back in full, so damage to it since is caught.
+	TrustPartHash bool
+
+	// Connections above 1 download byte ranges in parallel when the server
+	// supports it. 0 decides from the first response: autoConnections for a
+	// file of at least autoParallelSize from a server that takes ranges, a
+	// single stream otherwise.
+	Connections int
+
+	// MaxConnections caps the connections open at once, chunk workers,
+	// probes and retries together, for servers that limit connections per
+	// client. Zero means no limit. conns holds the slots, see connlimit.go.
+	MaxConnections int
+	conns          connLimit
+
+	// BufferSize is the size of the copy buffer, defaultBufferSize if 0
+	BufferSize int64
+
+	// MaxSize is the largest file that will be downloaded, checked against
+	// Content-Length up front and against the bytes written as they arrive.
+	// Zero means no limit.
+	MaxSize int64
+
+	// CASDir keeps downloads under their sha256, with the output a symlink
+	// to the cached file. A file already in the cache isn't downloaded again.
+	CASDir string
+
+	// Extract unpacks the downloaded zip into this directory; Clean removes
+	// the zip afterwards
+	Extract string
+	Clean   bool
+
+	// Retries is how many more times a URL is tried after a failure, waiting
+	// twice as long before each attempt. The .part file is kept in between
+	// so a retry resumes where the last attempt stopped.
+	Retries int
+
+	// AttemptTimeout cancels a single try, which then counts as failed and
+	// is retried. TotalTimeout is a deadline for the whole download, across
+	// all attempts and mirrors. Zero means no limit.
+	AttemptTimeout time.Duration
+	TotalTimeout   time.Duration
+
+	// StallTimeout fails an attempt when no data arrives for this long,
+	// e.g. a server that sent the headers and then went quiet. Zero means
+	// no limit.
+	StallTimeout time.Duration
+
+	// ExpectType is the media type the response must have, e.g.
+	// application/zip; empty accepts any
+	ExpectType string
+
+	// Wait keeps trying for this long while the server can't be reached,
+	// e.g. during boot before the network is up
+	Wait time.Duration
+
+	// retry counts the retries of the current URL, for the progress line
+	retry int
+	// stall is told about every byte received, see StallTimeout
+	stall *stallTimer
+
+	// Metrics is told about each download; nil means no metrics
+	Metrics Metrics
+
+	// Log gets a structured record of each phase, see logging.go; nil means
+	// no log. NoProgress hides the progress bar.
+	Log        *slog.Logger
+	NoProgress bool
+
+	// Quiet drops progress and informational messages, errors are still
+	// returned
+	Quiet bool
+
+	// NoColor keeps the result messages plain even on a terminal
+	NoColor bool
+}
+
+// ErrInterrupted is returned when the download was cancelled, e.g. by Ctrl-C.
+var ErrInterrupted = errors.New("download interrupted")
+
+// ErrChecksumMismatch is returned when the file doesn't have the expected
+// checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// errResumeMismatch is returned by fetch when a resumed file fails the
+// checksum. The .part is gone by then; fetchFresh downloads the file once
+// more from the start.
+var errResumeMismatch = errors.New("checksum mismatch after resuming")
+
+// ErrTooLarge is returned when the file is bigger than MaxSize. The partial
+// file is removed.
+var ErrTooLarge = errors.New("file too large")
+
+// Backoff between retries of the same URL
+const (
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// waitInterval is how often -wait tries a host that can't be reached
+const waitInterval = 5 * time.Second
+
+// Connections used when Connections is 0, for files of at least
+// autoParallelSize; smaller files aren't worth the extra requests
+const (
+	autoConnections  = 4
+	autoParallelSize = 32 << 20
+)
+
+// unreachable reports whether err means the server couldn't be reached at
+// all, e.g. the name doesn't resolve or the connection was refused, as
+// opposed to the server answering with an error.
+func unreachable(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial")
+}
+
+// statusError is an unexpected HTTP status from the server.
+type statusError struct {
+	Status string
+	Code   int
+}
+
+func (e *statusError) Error() string { return "downloading file: " + e.Status }
+
+// retryable reports whether trying the same URL again might help. Client
+// errors such as 404 or 403 won't go away by themselves.
+func retryable(err error) bool {
+	if errors.Is(err, ErrUnexpectedContent) || errors.Is(err, ErrTooLarge) {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.Code >= 500 || status.Code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// DownloadResult describes a finished download.
+type DownloadResult struct {
+	BytesWritten int64         `json:"bytes_written"`
+	Duration     time.Duration `json:"-"`
+	FinalURL     string        `json:"final_url"`
+	Algorithm    string        `json:"algorithm"`
+	Checksum     string        `json:"checksum"`
+	// Retries counts the failed attempts before the last one
+	Retries int `json:"retries"`
+	// Protocol is the HTTP version the server answered with, e.g. HTTP/2.0
+	Protocol   string `json:"protocol,omitempty"`
+	ConnReused bool   `json:"conn_reused"`
+}
+
+// Throughput returns the average download speed in bytes per second.
+func (r DownloadResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.BytesWritten) / r.Duration.Seconds()
+}
+
+// bufferSize returns the copy buffer size to use.
+func (o options) bufferSize() int64 {
+	if o.BufferSize > 0 {
+		return o.BufferSize
+	}
+	return defaultBufferSize
+}
+
+// progressOut is where the progress bar is drawn: logOut, or nowhere with
+// NoProgress.
+func (o options) progressOut(logOut io.Writer) io.Writer {
+	if o.NoProgress {
+		return io.Discard
+	}
+	return logOut
+}
+
+// Download tries each URL in turn, writing to the same output and checking
+// the same checksum, and stops at the first one that succeeds.
+func Download(ctx context.Context, opts options) (DownloadResult, error) {
+	if opts.Metrics == nil {
+		opts.Metrics = nopMetrics{}
+	}
+	if opts.Log == nil {
+		opts.Log = nopLogger
+	}
+	if opts.Headers == nil {
+		opts.Headers = http.Header{}
+	}
+	if opts.MaxConnections > 0 && opts.conns == nil {
+		opts.conns = make(connLimit, opts.MaxConnections)
+	}
+	if opts.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.TotalTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	opts.Metrics.DownloadStarted()
+
+	for _, url := range opts.URLs {
+		if err := checkScheme(url); err != nil {
+			opts.Metrics.DownloadFailed()
+			return DownloadResult{}, err
+		}
+	}
+	output := opts.Output
+	if output == "" {
+		if strings.HasPrefix(strings.ToLower(opts.URLs[0]), "data:") {
+			opts.Metrics.DownloadFailed()
+			return DownloadResult{}, errors.New("a data: URL has no file name, use -output")
+		}
+		output = path.Base(strings.SplitN(opts.URLs[0], "?", 2)[0])
+	}
+
+	algo, err := checksumAlgo(opts)
+	if err != nil {
+		opts.Metrics.DownloadFailed()
+		return DownloadResult{}, err
+	}
+	opts.HashAlgo = algo
+
+	if opts.Extract != "" && (output == "-" || !strings.EqualFold(filepath.Ext(output), ".zip")) {
+		opts.Metrics.DownloadFailed()
+		return DownloadResult{}, fmt.Errorf("-extract needs a .zip output file, not %s", output)
+	}
+
+	// Messages and progress go to stderr when the file itself goes to stdout
+	var logOut io.Writer = os.Stdout
+	if opts.Quiet {
+		logOut = io.Discard
+	} else if output == "-" {
+		logOut = os.Stderr
+	}
+	if output != "-" {
+		if err := checkOutputDir(filepath.Dir(output), opts.MkdirAll); err != nil {
+			opts.Metrics.DownloadFailed()
+			return DownloadResult{}, err
+		}
+		release, err := lockOutput(output)
+		if err != nil {
+			opts.Metrics.DownloadFailed()
+			return DownloadResult{}, err
+		}
+		defer release()
+	}
+
+	if opts.CASDir != "" {
+		if output == "-" || opts.HashAlgo != "sha256" {
+			opts.Metrics.DownloadFailed()
+			return DownloadResult{}, errors.New("-cas-dir needs an output file and a sha256 checksum")
+		}
+		if err := checkOutputDir(opts.CASDir, true); err != nil {
+			opts.Metrics.DownloadFailed()
+			return DownloadResult{}, err
+		}
+		if opts.Checksum != "" {
+			found, err := casLookup(opts.CASDir, opts.Checksum, output)
+			if err != nil {
+				opts.Metrics.DownloadFailed()
+				return DownloadResult{}, err
+			}
+			if found {
+				fmt.Fprintln(logOut, "Found in cache:", casPath(opts.CASDir, opts.Checksum))
+				opts.Metrics.DownloadFinished(time.Since(start))
+				return DownloadResult{Algorithm: algo, Checksum: strings.ToLower(opts.Checksum)}, nil
+			}
+		}
+	}
+
+	var result DownloadResult
+	for i, url := range opts.URLs {
+		result, err = fetchWithRetry(ctx, url, output, logOut, opts)
+		if err == nil {
+			if len(opts.URLs) > 1 {
+				fmt.Fprintln(logOut, "Downloaded from", url)
+			}
+			// An up to date file has no checksum and is already in place
+			if opts.CASDir != "" && result.Checksum != "" {
+				if err := casStore(opts.CASDir, result.Checksum, output, logOut); err != nil {
+					opts.Metrics.DownloadFailed()
+					return result, err
+				}
+			}
+			if opts.Extract != "" {
+				if err := unpack(output, logOut, opts); err != nil {
+					opts.Metrics.DownloadFailed()
+					return result, err
+				}
+			}
+			opts.Metrics.DownloadFinished(time.Since(start))
+			return result, nil
+		}
+		// Interrupted or out of time: don't move on to the next mirror
+		if ctx.Err() != nil {
+			if output != "-" && !opts.KeepPartial {
+				clearResume(output)
+			}
+			opts.Metrics.DownloadFailed()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return result, fmt.Errorf("download timed out after %s, last error: %w", time.Since(start).Round(time.Second), err)
+			}
+			return result, fmt.Errorf("%w: %w", ErrInterrupted, ctx.Err())
+		}
+		// Bytes already piped to stdout can't be taken back
+		if output == "-" && result.BytesWritten > 0 {
+			break
+		}
+		if i < len(opts.URLs)-1 {
+			fmt.Fprintf(logOut, "Mirror %s failed: %v\n", url, err)
+			opts.Metrics.Retry()
+		}
+	}
+	opts.Metrics.DownloadFailed()
+	return result, err
+}
+
+// unpack extracts the downloaded zip into opts.Extract and removes it when
+// opts.Clean is set.
+func unpack(output string, logOut io.Writer, opts options) error {
+	if err := checkOutputDir(opts.Extract, true); err != nil {
+		return err
+	}
+	if err := extractZip(output, opts.Extract); err != nil {
+		return err
+	}
+	fmt.Fprintln(logOut, "Extracted to", opts.Extract)
+	if opts.Clean {
+		os.Remove(etagPath(output))
+		return os.Remove(output)
+	}
+	return nil
+}
+
+// fetchWithRetry calls fetch until it succeeds, up to opts.Retries more
+// times, with exponential backoff in between. Each attempt gets at most
+// opts.AttemptTimeout. It gives up early when the context is cancelled, the
+// error isn't retryable or bytes have already gone to stdout.
+//
+// While the host can't be reached at all and opts.Wait hasn't run out, it
+// keeps trying every waitInterval without using up the retries.
+func fetchWithRetry(ctx context.Context, url, output string, logOut io.Writer, opts options) (DownloadResult, error) {
+	delay := retryDelay
+	waitUntil := time.Now().Add(opts.Wait)
+	for attempt := 0; ; attempt++ {
+		result, err := fetchAttempt(ctx, url, output, logOut, opts)
+		for err != nil && ctx.Err() == nil && unreachable(err) && time.Now().Before(waitUntil) {
+			wait := min(waitInterval, time.Until(waitUntil))
+			fmt.Fprintf(logOut, "Can't reach %s yet (%v), trying again in %s\n", url, err, wait.Round(time.Second))
+			opts.Log.Warn("wait", "url", redactURL(url), "error", err.Error())
+			select {
+			case <-ctx.Done():
+				return result, err
+			case <-time.After(wait):
+			}
+			result, err = fetchAttempt(ctx, url, output, logOut, opts)
+		}
+		result.Retries = attempt
+		if err == nil || attempt >= opts.Retries || ctx.Err() != nil || !retryable(err) {
+			return result, err
+		}
+		if output == "-" && result.BytesWritten > 0 {
+			return result, err
+		}
+		fmt.Fprintf(logOut, "Attempt %d failed: %v, retrying in %s\n", attempt+1, err, delay)
+		opts.Log.Warn("retry", "url", redactURL(url), "attempt", attempt+1, "error", err.Error(), "delay_seconds", delay.Seconds())
+		opts.Metrics.Retry()
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRetryDelay)
+		opts.retry = attempt + 1
+	}
+}
+
+// fetchAttempt is one call to fetch, limited to opts.AttemptTimeout and
+// opts.StallTimeout.
+func fetchAttempt(ctx context.Context, url, output string, logOut io.Writer, opts options) (DownloadResult, error) {
+	stallCtx, stall, stopStall := withStallTimeout(ctx, opts.StallTimeout)
+	defer stopStall()
+	opts.stall = stall
+	if opts.AttemptTimeout <= 0 {
+		result, err := fetchFresh(stallCtx, url, output, logOut, opts)
+		return result, stallError(stallCtx, opts.StallTimeout, err)
+	}
+	attemptCtx, cancel := context.WithTimeout(stallCtx, opts.AttemptTimeout)
+	defer cancel()
+	result, err := fetchFresh(attemptCtx, url, output, logOut, opts)
+	if err != nil && stallCtx.Err() == nil && attemptCtx.Err() != nil {
+		err = fmt.Errorf("attempt timed out after %s: %w", opts.AttemptTimeout, err)
+	}
+	return result, stallError(stallCtx, opts.StallTimeout, err)
+}
+
+// fetchFresh is fetch, run a second time from the start when a resumed
+// download fails the checksum. The first response is closed by then, so the
+// second request doesn't wait on its connection slot.
+func fetchFresh(ctx context.Context, url, output string, logOut io.Writer, opts options) (DownloadResult, error) {
+	result, err := fetch(ctx, url, output, logOut, opts)
+	if errors.Is(err, errResumeMismatch) {
+		fmt.Fprintln(logOut, "Checksum mismatch after resuming, downloading again from the start")
+		result, err = fetch(ctx, url, output, logOut, opts)
+	}
+	return result, err
+}
+
+// fetch downloads url into output. The file is written to output.part and
+// only renamed into place once it is complete and the checksum matches; an
+// interrupted download is continued on the next run if the server still has
+// the same file. The result is filled in as far as the download got, so
+// BytesWritten is set even when an error is returned.
+func fetch(ctx context.Context, url, output string, logOut io.Writer, opts options) (DownloadResult, error) {
+	start := time.Now()
+	result := DownloadResult{FinalURL: url}
+	checksum := opts.Checksum
+	toStdout := output == "-"
+
+	// Use parallel connections when the server can serve byte ranges
+	if opts.Connections > 1 && !toStdout {
+		probe, err := Probe(ctx, url, opts)
+		if err == nil && !opts.Force && unchangedSince(output, probe) && existingVerified(output, opts) {
+			fmt.Fprintln(logOut, "File is up to date")
+			return result, nil
+		}
+		if err == nil && probe.AcceptRanges && probe.ContentLength > 0 {
+			if err := checkContentType(probe.ContentType, opts.ExpectType); err != nil {
+				return result, err
+			}
+			// The chunks only ever fetch probe.ContentLength bytes
+			if err := checkSize(probe.ContentLength, opts.MaxSize); err != nil {
+				clearResume(output)
+				return result, err
+			}
+			return fetchChunked(ctx, url, probe, output, logOut, opts)
+		}
+	}
+
+	// Pick up an interrupted download of the same file
+	var state resumeState
+	var offset int64
+	if !toStdout {
+		state, offset = loadResume(output)
+	}
+
+	client, err := clientFor(url, opts)
+	if err != nil {
+		return result, err
+	}
+	// Note whether the request went over a kept-alive connection
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { result.ConnReused = info.Reused },
+	})
+	req, err := newRequest(ctx, url, output, offset, state, opts)
+	if err != nil {
+		return result, fmt.Errorf("creating request: %w", err)
+	}
+	// Ask the server to skip the body when our copy is still current
+	if !toStdout && !opts.Force && offset == 0 && existingVerified(output, opts) {
+		for k, v := range conditionalHeaders(output) {
+			req.Header[k] = v
+		}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("fetching URL: %w", err)
+	}
+	// The saved part doesn't fit the file any more, start over
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		res.Body.Close()
+		clearResume(output)
+		state, offset = resumeState{}, 0
+		req, err = newRequest(ctx, url, output, 0, state, opts)
+		if err != nil {
+			return result, fmt.Errorf("creating request: %w", err)
+		}
+		res, err = client.Do(req)
+		if err != nil {
+			return result, fmt.Errorf("fetching URL: %w", err)
+		}
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		fmt.Fprintln(logOut, "File is up to date")
+		return result, nil
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		if start, err := rangeStart(res.Header.Get("Content-Range")); err != nil || start != offset {
+			return result, fmt.Errorf("server resumed at the wrong offset (%s)", res.Header.Get("Content-Range"))
+		}
+		fmt.Fprintf(logOut, "Resuming from byte %d\n", offset)
+		opts.Log.Info("resume", "url", redactURL(url), "offset", offset)
+	case res.StatusCode == http.StatusOK:
+		// If-Range didn't match, so the file changed and the part is useless
+		if offset > 0 {
+			fmt.Fprintln(logOut, "File changed on the server, restarting download")
+		}
+		offset = 0
+	default:
+		return result, &statusError{Status: res.Status, Code: res.StatusCode}
+	}
+	result.Protocol = res.Proto
+	if finalURL := res.Request.URL.String(); finalURL != url {
+		fmt.Fprintln(logOut, "Redirected to", finalURL)
+		result.FinalURL = finalURL
+	}
+	encoding := res.Header.Get("Content-Encoding")
+	raw := opts.Raw || isCompressedName(output)
+	if err := checkContentType(res.Header.Get("Content-Type"), opts.ExpectType); err != nil {
+		return result, err
+	}
+
+	// The first response tells whether parallel ranges would work; if so
+	// this one is dropped and the file fetched in chunks instead
+	if opts.Connections == 0 && offset == 0 && !toStdout && encoding == "" && res.StatusCode == http.StatusOK {
+		if probe := probeResponse(res); probe.AcceptRanges && probe.ContentLength >= autoParallelSize {
+			res.Body.Close()
+			if err := checkSize(probe.ContentLength, opts.MaxSize); err != nil {
+				clearResume(output)
+				return result, err
+			}
+			fmt.Fprintf(logOut, "Server accepts byte ranges, downloading with %d connections\n", autoConnections)
+			opts.Connections = autoConnections
+			return fetchChunked(ctx, url, probe, output, logOut, opts)
+		}
+	}
+
+	// Get the content length of the file, -1 when the server doesn't send one.
+	// For an encoded body this is the compressed size.
+	contentLength := res.ContentLength
+
+	// Make sure the file fits before downloading it
+	if !toStdout && contentLength > 0 {
+		if free, ok := freeSpace(filepath.Dir(output)); ok && free < uint64(contentLength)+diskSpaceMargin {
+			return result, fmt.Errorf("not enough disk space: need %d bytes, %d available", contentLength, free)
+		}
+	}
+	if contentLength >= 0 {
+		contentLength += offset
+	}
+	// An encoded body only shows its real size once decoded, so that is
+	// left to the limit on the copy below
+	if encoding == "" || raw {
+		if err := checkSize(contentLength, opts.MaxSize); err != nil {
+			if !toStdout {
+				clearResume(output)
+			}
+			return result, err
+		}
+	}
+
+	hash := hashAlgos[opts.HashAlgo]()
+	var dst io.Writer
+	var flush func() error
+	if toStdout {
+		buf := bufio.NewWriter(os.Stdout)
+		dst, flush = buf, buf.Flush
+	} else {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if offset > 0 {
+			flags = os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(partPath(output), flags, 0644)
+		if err != nil {
+			return result, fmt.Errorf("creating file: %w", err)
+		}
+		defer file.Close()
+		dst, flush = file, file.Close
+
+		if offset > 0 {
+			// The checksum covers the whole file, so catch up on what we
+			// already have
+			saved := state
+			if checksum != "" && !opts.TrustPartHash {
+				saved.HashState = nil
+			}
+			if err := resumeHash(hash, saved, opts.HashAlgo, partPath(output), offset); err != nil {
+				return result, fmt.Errorf("reading partial file: %w", err)
+			}
+		} else {
+			state = resumeState{
+				URL:          result.FinalURL,
+				ETag:         res.Header.Get("ETag"),
+				LastModified: res.Header.Get("Last-Modified"),
+				Decoded:      encoding != "" && !raw,
+			}
+			if err := saveResume(output, state); err != nil {
+				return result, fmt.Errorf("saving resume state: %w", err)
+			}
+		}
+	}
+
+	// Start a goroutine to update the progress bar
+	progress, stopProgress := startProgress(opts.progressOut(logOut), offset, contentLength, opts.retry, opts.Metrics)
+
+	// Progress counts the bytes on the wire so it matches Content-Length, the
+	// checksum covers the bytes that land on disk
+	var body io.Reader = io.TeeReader(res.Body, io.MultiWriter(progress, opts.stall))
+	if !raw {
+		body, err = decodeBody(encoding, body)
+		if err != nil {
+			stopProgress()
+			return result, fmt.Errorf("decoding response: %w", err)
+		}
+	}
+
+	// Copy the response body to the output, updating the progress bar and the checksum
+	var limit io.Writer = io.Discard
+	if opts.MaxSize > 0 {
+		limit = &sizeLimit{remaining: opts.MaxSize - offset, max: opts.MaxSize}
+	}
+	// The hash comes after the file, so it never sees bytes the .part lacks
+	hashed := &countingWriter{w: hash}
+	result.BytesWritten, err = io.CopyBuffer(io.MultiWriter(limit, dst, hashed), body, make([]byte, opts.bufferSize()))
+	stopProgress()
+	if errors.Is(err, ErrTooLarge) {
+		if !toStdout {
+			flush()
+			clearResume(output)
+		}
+		return result, err
+	}
+	if err != nil {
+		// Let the next attempt continue the hash instead of starting over
+		if !toStdout && !state.Decoded && flush() == nil {
+			saveHashState(&state, hash, opts.HashAlgo, offset+hashed.n)
+			saveResume(output, state)
+		}
+		return result, fmt.Errorf("writing file: %w", err)
+	}
+	if err := flush(); err != nil {
+		return result, fmt.Errorf("writing file: %w", err)
+	}
+
+	result.Algorithm = opts.HashAlgo
+	result.Checksum = hex.EncodeToString(hash.Sum(nil))
+	result.Duration = time.Since(start)
+
+	// An error page saved under the file's name is caught here even without
+	// a checksum, by looking at the bytes that were written
+	if !toStdout {
+		if err := checkMagic(partPath(output), output); err != nil {
+			clearResume(output)
+			return result, err
+		}
+	}
+
+	if checksum != "" {
+		got := result.Checksum
+		logChecksum(opts.Log, opts.HashAlgo, checksum, got, strings.EqualFold(got, checksum))
+		if !strings.EqualFold(got, checksum) {
+			if !toStdout {
+				clearResume(output)
+			}
+			// The hash covers the resumed bytes read back from disk, so the
+			// old part may be what's corrupt
+			if offset > 0 {
+				return result, errResumeMismatch
+			}
+			return result, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum, got)
+		}
+		fmt.Fprintln(logOut, "Checksum verified")
+	}
+
+	if !toStdout {
+		if err := os.Rename(partPath(output), output); err != nil {
+			return result, fmt.Errorf("saving file: %w", err)
+		}
+		os.Remove(statePath(output))
+		saveETag(output, res.Header.Get("ETag"))
+		if !opts.NoPreserveTime {
+			preserveTime(output, res.Header.Get("Last-Modified"))
+		}
+	}
+
+	fmt.Fprintln(logOut, paint(logOut, opts.NoColor, colorGreen, "File downloaded successfully"))
+	return result, nil
+}
+
+// newRequest builds the GET for url. With a non-zero offset it asks for the
+// rest of the file, guarded by If-Range so a changed file comes back whole.
+// A compressed body is only asked for when output isn't compressed already.
+func newRequest(ctx context.Context, url, output string, offset int64, state resumeState, opts options) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = opts.Headers.Clone()
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", state.validator())
+		// Byte ranges only line up with the unencoded file
+		req.Header.Set("Accept-Encoding", "identity")
+	} else if !opts.Raw && !isCompressedName(output) && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	return req, nil
+}
+
+// checkSize fails when a file of size bytes is over max. An unknown size
+// (-1) or no limit (0) passes.
+func checkSize(size, max int64) error {
+	if max > 0 && size > max {
+		return fmt.Errorf("%w: %d bytes, -max-size is %d", ErrTooLarge, size, max)
+	}
+	return nil
+}
+
+// sizeLimit is an io.Writer that fails with ErrTooLarge once more than
+// remaining bytes go through it, stopping the copy it sits in.
+type sizeLimit struct {
+	remaining, max int64
+}
+
+func (l *sizeLimit) Write(b []byte) (int, error) {
+	if int64(len(b)) > l.remaining {
+		return 0, fmt.Errorf("%w: more than %d bytes (-max-size)", ErrTooLarge, l.max)
+	}
+	l.remaining -= int64(len(b))
+	return len(b), nil
+}
+
+// checkOutputDir makes sure dir exists, creating it when mkdir is set, and
+// that we can write to it, so a bad path fails before any request is made.
+func checkOutputDir(dir string, mkdir bool) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) && mkdir {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+		return nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("output directory %s does not exist (use -mkdir to create it)", dir)
+	}
+	if err != nil {
+		return fmt.Errorf("checking output directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("output directory %s is not a directory", dir)
+	}
+
+	probe, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// preserveTime sets the mtime of name to the Last-Modified header value. An
+// absent or unparseable header is ignored.
+func preserveTime(name, lastModified string) {
+	t, err := http.ParseTime(lastModified)
+	if err != nil {
+		return
+	}
+	os.Chtimes(name, t, t)
+}
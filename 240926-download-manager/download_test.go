@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testOptions returns quiet options for downloading url to output.
+func testOptions(url, output string) options {
+	return options{URLs: []string{url}, Output: output, Quiet: true, NoProgress: true}
+}
+
+// truncatedBody answers like a normal GET but drops the connection halfway
+// through the body, leaving a .part to resume.
+func truncatedBody(w http.ResponseWriter, etag string, content []byte) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Write(content[:len(content)/2])
+}
+
+func TestResumeIfRange(t *testing.T) {
+	old := bytes.Repeat([]byte("old file "), 1000)
+	changed := bytes.Repeat([]byte("NEW FILE "), 1200)
+
+	tests := []struct {
+		name       string
+		secondETag string
+		second     []byte
+		wantStatus int
+	}{
+		{"same file resumes", `"v1"`, old, http.StatusPartialContent},
+		{"changed file restarts", `"v2"`, changed, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var ifRange atomic.Value
+			var status atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					truncatedBody(w, `"v1"`, old)
+					return
+				}
+				ifRange.Store(r.Header.Get("If-Range"))
+				w.Header().Set("ETag", tt.secondETag)
+				rec := &statusRecorder{ResponseWriter: w}
+				http.ServeContent(rec, r, "file.bin", time.Time{}, bytes.NewReader(tt.second))
+				status.Store(int32(rec.status))
+			}))
+			defer srv.Close()
+
+			output := filepath.Join(t.TempDir(), "file.bin")
+			opts := testOptions(srv.URL+"/file.bin", output)
+			opts.KeepPartial = true
+			if _, err := Download(context.Background(), opts); err == nil {
+				t.Fatal("first download succeeded although the body was cut short")
+			}
+			if _, err := os.Stat(partPath(output)); err != nil {
+				t.Fatalf("no .part left to resume: %v", err)
+			}
+
+			if _, err := Download(context.Background(), opts); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := ifRange.Load().(string); got != `"v1"` {
+				t.Errorf("If-Range = %q, want the first ETag", got)
+			}
+			if got := int(status.Load()); got != tt.wantStatus {
+				t.Errorf("server answered %d, want %d", got, tt.wantStatus)
+			}
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.second) {
+				t.Errorf("file has %d bytes starting %q, want the %d bytes of the server's file",
+					len(data), data[:min(len(data), 20)], len(tt.second))
+			}
+			if _, err := os.Stat(partPath(output)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf(".part left behind: %v", err)
+			}
+		})
+	}
+}
+
+// statusRecorder notes the status code a handler sent.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name         string
+		slow         int32 // requests that hang before the fast one
+		attempt      time.Duration
+		total        time.Duration
+		retries      int
+		wantErr      string
+		wantRequests int32
+	}{
+		{"attempt times out and is retried", 1, 100 * time.Millisecond, 0, 1, "", 2},
+		{"total deadline ends the retries", 100, 100 * time.Millisecond, 300 * time.Millisecond, 5, "download timed out", 1},
+		{"total deadline without attempt timeout", 100, 0, 200 * time.Millisecond, 5, "download timed out", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.slow {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(5 * time.Second):
+					}
+					return
+				}
+				w.Write([]byte("done\n"))
+			}))
+			defer srv.Close()
+
+			output := filepath.Join(t.TempDir(), "file.txt")
+			opts := testOptions(srv.URL+"/file.txt", output)
+			opts.AttemptTimeout, opts.TotalTimeout, opts.Retries = tt.attempt, tt.total, tt.retries
+			start := time.Now()
+			_, err := Download(context.Background(), opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Download error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if elapsed := time.Since(start); elapsed > tt.total+time.Second {
+					t.Errorf("gave up after %s, the total timeout is %s", elapsed, tt.total)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("%d requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestTinyFiles(t *testing.T) {
+	for _, content := range []string{"", "x"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write([]byte(content))
+		}))
+		output := filepath.Join(t.TempDir(), "file.txt")
+		result, err := Download(context.Background(), testOptions(srv.URL+"/file.txt", output))
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%d byte download: %v", len(content), err)
+		}
+		if result.BytesWritten != int64(len(content)) {
+			t.Errorf("%d byte download wrote %d bytes", len(content), result.BytesWritten)
+		}
+		if data, err := os.ReadFile(output); err != nil || string(data) != content {
+			t.Errorf("%d byte download left %q, %v", len(content), data, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decodeBody wraps r so it yields the decoded bytes for the given
+// Content-Encoding. An empty or identity encoding returns r unchanged.
+func decodeBody(encoding string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q (use -raw to save it as is)", encoding)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// extractZip unpacks the zip archive name into dir, keeping the file modes
+// from the archive. Entries that would land outside dir, such as
+// "../../etc/passwd" or absolute paths, and symlinks are refused before
+// anything is written.
+func extractZip(name, dir string) error {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if !filepath.IsLocal(filepath.FromSlash(f.Name)) {
+			return fmt.Errorf("archive entry %q points outside %s", f.Name, dir)
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %q is a symlink, refusing to extract it", f.Name)
+		}
+	}
+
+	for _, f := range archive.File {
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, f.Mode().Perm()|0700); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := extractFile(f, target); err != nil {
+			return fmt.Errorf("extracting %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, target string) error {
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	// OpenFile only applies the mode to new files and the umask still applies
+	if err := os.Chmod(target, f.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, f.Modified, f.Modified)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// runGet is the download for scripts: every safety feature is on and a
+// checksum is required. It returns the exit code. The steps are:
+//
+//  1. The checksum is taken from -sha256/-checksum or looked up in the -sums
+//     manifest; without one nothing is downloaded.
+//  2. The output directory is checked (and created with -mkdir) and
+//     <output>.lock is locked, so a second download of the same file fails.
+//  3. The file is written to <output>.part. A .part left by an earlier run
+//     is continued with a Range request guarded by If-Range, so it is only
+//     resumed if the ETag/Last-Modified still match; otherwise the server
+//     sends the whole file and the .part is rewritten from the start.
+//  4. A failed attempt is retried up to -retries times, waiting 1s, 2s, 4s
+//     and so on (at most 30s) in between. The .part is kept, so each retry
+//     resumes. 4xx responses other than 429 are not retried. An attempt
+//     that receives nothing for -stall-timeout (1m) counts as failed.
+//  5. Once complete the whole file is hashed, reading resumed bytes back from
+//     disk rather than trusting the hash state saved with the .part. On a
+//     mismatch the .part and its state are deleted and the next URL, if any,
+//     is tried.
+//  6. The modification time is set from Last-Modified and the .part is
+//     renamed to the output, so the output only ever holds a verified file.
+//  7. With -extract the zip is unpacked, only after it was verified, and
+//     removed again with -clean. Entries escaping the target directory
+//     abort the extraction before anything is written.
+//
+// On Ctrl-C the .part and its state are kept for the next run to resume.
+func runGet(args []string) int {
+	opts := options{Headers: http.Header{}, KeepPartial: true}
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	fs.StringVar(&opts.Output, "output", "", "File to save to (default: file name from the URL)")
+	fs.Func("sha256", "Expected SHA-256 checksum of the file (hex), same as -checksum with -algo sha256", func(s string) error {
+		opts.Checksum, opts.HashAlgo = s, "sha256"
+		return nil
+	})
+	fs.StringVar(&opts.Checksum, "checksum", "", "Expected checksum of the file (hex), see -algo")
+	fs.StringVar(&opts.HashAlgo, "algo", "", "Checksum algorithm: sha256, sha512, sha1 or md5 (default: from the digest length)")
+	fs.BoolVar(&opts.AllowWeakHash, "allow-weak-hash", false, "Accept sha1 and md5 checksums")
+	sumsURL := fs.String("sums", "", "URL of a SHA256SUMS manifest listing the file")
+	fs.Var(headerFlag(opts.Headers), "header", "Extra request header \"Key: Value\" (repeatable)")
+	addAuthFlags(fs, &opts.Auth)
+	fs.IntVar(&opts.Retries, "retries", 3, "Times to retry a failed URL, with exponential backoff")
+	fs.DurationVar(&opts.AttemptTimeout, "attempt-timeout", 0, "Give up on one attempt after this long and retry (0 for no limit)")
+	fs.DurationVar(&opts.StallTimeout, "stall-timeout", time.Minute, "Fail the attempt, and retry, when no data arrives for this long (0 for no limit)")
+	fs.DurationVar(&opts.TotalTimeout, "total-timeout", 0, "Give up on the whole download, retries included, after this long (0 for no limit)")
+	fs.DurationVar(&opts.Wait, "wait", 0, "Keep trying for up to this long while the server is unreachable (DNS failure, connection refused)")
+	fs.IntVar(&opts.MaxRedirects, "max-redirects", 10, "Maximum number of redirects to follow")
+	fs.StringVar(&opts.Proxy, "proxy", "", "Proxy URL; default from HTTP_PROXY/NO_PROXY")
+	opts.BufferSize = defaultBufferSize
+	fs.Var((*sizeFlag)(&opts.MaxSize), "max-size", "Refuse files larger than this, e.g. 500M (default no limit)")
+	fs.Var((*sizeFlag)(&opts.BufferSize), "buffer-size", "Copy buffer size, e.g. 1MB for fast links")
+	fs.BoolVar(&opts.HTTP1, "http1", false, "Use HTTP/1.1 even when the server supports HTTP/2")
+	fs.StringVar(&opts.CACert, "cacert", "", "PEM file with extra CA certificates to trust")
+	fs.BoolVar(&opts.MkdirAll, "mkdir", false, "Create the output directory if it doesn't exist")
+	fs.StringVar(&opts.ExpectType, "expect-type", "", "Fail unless the response has this Content-Type, e.g. application/zip")
+	fs.StringVar(&opts.CASDir, "cas-dir", "", "Keep the file in this directory under its sha256 and symlink the output to it")
+	fs.StringVar(&opts.Extract, "extract", "", "Extract the verified .zip into this directory")
+	fs.BoolVar(&opts.Clean, "clean", false, "Delete the .zip after extracting it")
+	fs.BoolVar(&opts.Quiet, "quiet", false, "Only print errors")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "Don't color the result even on a terminal")
+	jsonOut := fs.Bool("json", false, "Print the download result as JSON")
+	logFile := fs.String("log-file", "", "Append a JSON log of each phase to this file (- for stderr); a file replaces the progress bar")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: get [flags] URL [mirror URL...]")
+		fmt.Fprintln(fs.Output(), "       get [flags] -auth-request \"POST https://api.example.com/...\"")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if (fs.NArg() == 0) == (opts.Auth.URL == "") {
+		fs.Usage()
+		return exitUsage
+	}
+	if opts.Checksum == "" && *sumsURL == "" {
+		fmt.Fprintln(fs.Output(), "get needs -sha256, -checksum or -sums to verify the file")
+		return exitUsage
+	}
+	if opts.Output == "-" {
+		fmt.Fprintln(fs.Output(), "get can't write to stdout, the file is only moved into place once verified")
+		return exitUsage
+	}
+	opts.URLs = fs.Args()
+	return runDownload(opts, *sumsURL, *logFile, *jsonOut)
+}
@@ -1,3 +1,13 @@
 module github.com/shafiqsaaidin/go-project/240926-download-manager
 
 go 1.22.0
+
+require (
+	github.com/shafiqsaaidin/go-project/term v0.0.0
+	github.com/shafiqsaaidin/go-project/version v0.0.0
+)
+
+replace (
+	github.com/shafiqsaaidin/go-project/term => ../term
+	github.com/shafiqsaaidin/go-project/version => ../version
+)
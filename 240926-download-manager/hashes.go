@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// hashAlgos are the checksum algorithms -algo accepts.
+var hashAlgos = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// digestAlgos guesses the algorithm from the length of a hex digest.
+var digestAlgos = map[int]string{
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+// weakHash reports whether collisions can be made for algo, so a match
+// doesn't prove the file wasn't tampered with.
+func weakHash(algo string) bool {
+	return algo == "md5" || algo == "sha1"
+}
+
+// checksumAlgo works out the algorithm for opts.Checksum: opts.HashAlgo when
+// set, otherwise from the digest length, and sha256 when there is no
+// checksum at all. MD5 and SHA-1 are refused unless opts.AllowWeakHash.
+func checksumAlgo(opts options) (string, error) {
+	algo := strings.ToLower(opts.HashAlgo)
+	if algo == "" && opts.Checksum == "" {
+		return "sha256", nil
+	}
+	if algo == "" {
+		var ok bool
+		if algo, ok = digestAlgos[len(opts.Checksum)]; !ok {
+			return "", fmt.Errorf("can't tell the algorithm of a %d digit checksum, use -algo", len(opts.Checksum))
+		}
+	}
+	newHash, ok := hashAlgos[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown checksum algorithm %q (sha256, sha512, sha1 or md5)", opts.HashAlgo)
+	}
+	if want := 2 * newHash().Size(); opts.Checksum != "" && len(opts.Checksum) != want {
+		return "", fmt.Errorf("checksum has %d hex digits, %s needs %d", len(opts.Checksum), algo, want)
+	}
+	if weakHash(algo) && opts.Checksum != "" && !opts.AllowWeakHash {
+		return "", fmt.Errorf("%s is too weak to prove the file is genuine, pass -allow-weak-hash to use it anyway", algo)
+	}
+	return algo, nil
+}
@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockOutput creates output.lock exclusively so two downloads can't write the
+// same file at once. Without flock a crashed download leaves the lock file
+// behind, and it has to be removed by hand.
+func lockOutput(output string) (release func(), err error) {
+	name := lockPath(output)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("another download is already writing %s (remove %s if it isn't)", output, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating lock file: %w", err)
+	}
+	file.Close()
+	return func() { os.Remove(name) }, nil
+}
@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockOutput takes an flock on output.lock so two downloads can't write the
+// same file at once. The lock goes away with the process, so a crash never
+// leaves a stale one behind. Call release once the download is over.
+func lockOutput(output string) (release func(), err error) {
+	name := lockPath(output)
+	for {
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("creating lock file: %w", err)
+		}
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			file.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, fmt.Errorf("another download is already writing %s (%s is locked)", output, name)
+			}
+			return nil, fmt.Errorf("locking %s: %w", name, err)
+		}
+		// The previous holder may have removed the file between our open and
+		// lock, in which case the lock is on a file nobody else will see
+		held, err1 := file.Stat()
+		current, err2 := os.Stat(name)
+		if err1 == nil && err2 == nil && os.SameFile(held, current) {
+			return func() {
+				os.Remove(name)
+				file.Close()
+			}, nil
+		}
+		file.Close()
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// The download logs one JSON record per phase to -log-file, for unattended
+// runs whose logs are collected elsewhere. The events are:
+//
+//	auth      method, url, status, download_url, error (see -auth-request)
+//	start     url, output, urls
+//	resume    url, offset
+//	wait      url, error (host unreachable, see -wait)
+//	retry     url, attempt, error, delay_seconds
+//	checksum  algorithm, expected, actual, ok
+//	done      url, bytes, duration_seconds, retries, status, error
+//
+// status is ok, failed, checksum_mismatch or interrupted. URLs are logged
+// without their query and credentials, which for presigned URLs hold the
+// signature.
+
+// nopLogger drops every record; it is used when -log-file isn't set.
+var nopLogger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+// openLog returns a JSON logger writing to file, or to stderr for "-". The
+// file is appended to, so several runs can share it. Call close when done.
+func openLog(file string) (logger *slog.Logger, close func() error, err error) {
+	switch file {
+	case "":
+		return nopLogger, func() error { return nil }, nil
+	case "-":
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil)), func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening log file: %w", err)
+	}
+	return slog.New(slog.NewJSONHandler(f, nil)), f.Close, nil
+}
+
+// logChecksum records the outcome of a checksum comparison.
+func logChecksum(log *slog.Logger, algo, expected, actual string, ok bool) {
+	level := slog.LevelInfo
+	if !ok {
+		level = slog.LevelError
+	}
+	log.Log(context.Background(), level, "checksum", "algorithm", algo, "expected", expected, "actual", actual, "ok", ok)
+}
@@ -1,74 +1,273 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shafiqsaaidin/go-project/version"
 )
 
-type progressWriter struct {
-	progressChan chan int64
-}
+// Exit codes
+const (
+	exitFailure      = 1
+	exitUsage        = 2   // bad flags or arguments
+	exitVerifyFailed = 3   // checksum mismatch, or the file isn't in the -sums manifest
+	exitInterrupted  = 130 // Ctrl-C, as shells use for SIGINT
+)
 
-func (w *progressWriter) Write(p []byte) (int, error) {
-	w.progressChan <- int64(len(p))
-	return len(p), nil
-}
+const defaultURL = "https://github.com/XTLS/Xray-core/releases/download/v1.8.24/Xray-linux-64.zip"
 
 func main() {
-	url := "https://github.com/XTLS/Xray-core/releases/download/v1.8.24/Xray-linux-64.zip"
-	res, err := http.Get(url)
-	if err != nil {
-		fmt.Println("Error fetching URL: ", err)
-		return
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "get":
+			os.Exit(runGet(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "version":
+			version.Print(os.Stdout)
+			return
+		}
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("Error downloading file: ", res.Status)
+	opts := options{Headers: http.Header{}}
+	flag.Var((*urlsFlag)(&opts.URLs), "url", "URL of the file to download (repeat to add mirrors)")
+	mirrors := flag.String("mirrors", "", "File with more mirror URLs, one per line")
+	flag.StringVar(&opts.Output, "output", "", "File to save to, or - for stdout (default: file name from the URL)")
+	flag.Func("sha256", "Expected SHA-256 checksum of the file (hex), same as -checksum with -algo sha256", func(s string) error {
+		opts.Checksum, opts.HashAlgo = s, "sha256"
+		return nil
+	})
+	flag.StringVar(&opts.Checksum, "checksum", "", "Expected checksum of the file (hex), see -algo")
+	flag.StringVar(&opts.HashAlgo, "algo", "", "Checksum algorithm: sha256, sha512, sha1 or md5 (default: from the digest length)")
+	flag.BoolVar(&opts.AllowWeakHash, "allow-weak-hash", false, "Accept sha1 and md5 checksums")
+	sumsURL := flag.String("sums", "", "URL of a SHA256SUMS manifest to verify the download against")
+	flag.Var(headerFlag(opts.Headers), "header", "Extra request header \"Key: Value\" (repeatable)")
+	addAuthFlags(flag.CommandLine, &opts.Auth)
+	flag.IntVar(&opts.MaxRedirects, "max-redirects", 10, "Maximum number of redirects to follow")
+	flag.BoolVar(&opts.AllowCrossHostRedirect, "allow-cross-host-redirect", false, "Follow redirects to another host even with an Authorization header (the header is dropped)")
+	flag.StringVar(&opts.Proxy, "proxy", "", "Proxy URL (http://, https:// or socks5://, user:pass@ allowed); default from HTTP_PROXY/NO_PROXY")
+	opts.BufferSize = defaultBufferSize
+	flag.Var((*sizeFlag)(&opts.MaxSize), "max-size", "Refuse files larger than this, e.g. 500M (default no limit)")
+	flag.Var((*sizeFlag)(&opts.BufferSize), "buffer-size", "Copy buffer size, e.g. 1MB for fast links")
+	flag.BoolVar(&opts.HTTP1, "http1", false, "Use HTTP/1.1 even when the server supports HTTP/2")
+	flag.StringVar(&opts.CACert, "cacert", "", "PEM file with extra CA certificates to trust")
+	flag.BoolVar(&opts.Insecure, "insecure", false, "DANGEROUS: skip TLS certificate verification (lab use only)")
+	flag.BoolVar(&opts.MkdirAll, "mkdir", false, "Create the output directory if it doesn't exist")
+	flag.BoolVar(&opts.NoPreserveTime, "no-preserve-time", false, "Don't set the file's modification time from Last-Modified")
+	flag.BoolVar(&opts.KeepPartial, "keep-partial", false, "Keep the partial file when interrupted so the download can be resumed")
+	flag.BoolVar(&opts.TrustPartHash, "trust-part-hash", false, "On resume, continue the checksum state saved with the partial file instead of reading it back, even with -checksum")
+	flag.BoolVar(&opts.Force, "force", false, "Download even if the existing file is up to date")
+	flag.IntVar(&opts.Connections, "connections", 0, fmt.Sprintf("Parallel connections for servers that support byte ranges (0: %d for files of %dMB or more, else 1)", autoConnections, autoParallelSize>>20))
+	flag.IntVar(&opts.MaxConnections, "max-connections", 0, "Never have more than this many connections open at once (0 for no limit)")
+	flag.IntVar(&opts.Retries, "retries", 0, "Times to retry a failed URL, with exponential backoff")
+	flag.DurationVar(&opts.AttemptTimeout, "attempt-timeout", 0, "Give up on one attempt after this long and retry (0 for no limit)")
+	flag.DurationVar(&opts.TotalTimeout, "total-timeout", 0, "Give up on the whole download, retries included, after this long (0 for no limit)")
+	flag.DurationVar(&opts.StallTimeout, "stall-timeout", 0, "Fail the attempt, and retry, when no data arrives for this long (0 for no limit)")
+	flag.DurationVar(&opts.Wait, "wait", 0, "Keep trying for up to this long while the server is unreachable (DNS failure, connection refused)")
+	flag.BoolVar(&opts.Raw, "raw", false, "Save gzip/deflate encoded responses without decoding them")
+	flag.StringVar(&opts.ExpectType, "expect-type", "", "Fail unless the response has this Content-Type, e.g. application/zip")
+	flag.StringVar(&opts.CASDir, "cas-dir", "", "Keep the file in this directory under its sha256 and symlink the output to it")
+	flag.StringVar(&opts.Extract, "extract", "", "Extract the downloaded .zip into this directory")
+	flag.BoolVar(&opts.Clean, "clean", false, "Delete the .zip after extracting it")
+	flag.BoolVar(&opts.Quiet, "quiet", false, "Only print errors")
+	flag.BoolVar(&opts.NoColor, "no-color", false, "Don't color the result even on a terminal")
+	jsonOut := flag.Bool("json", false, "Print the download result as JSON")
+	logFile := flag.String("log-file", "", "Append a JSON log of each phase to this file (- for stderr); a file replaces the progress bar")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9100")
+	head := flag.Bool("head", false, "Only report the size, resumability, filename and validators without downloading")
+	bench := flag.Bool("benchmark", false, "Measure the download speed of each URL without saving anything, fastest first")
+	var benchBytes int64
+	flag.Var((*sizeFlag)(&benchBytes), "benchmark-bytes", "Stop measuring a URL after this much, e.g. 10M (default the whole file)")
+	benchTime := flag.Duration("benchmark-duration", 0, "Stop measuring a URL after this long (0 for the whole file)")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	config := flag.String("config", "", "JSON file with default flag values, e.g. {\"url\": \"...\", \"retries\": 3}")
+	flag.Parse()
+
+	if *showVersion {
+		version.Print(os.Stdout)
 		return
 	}
+	if *config != "" {
+		if err := applyConfig(flag.CommandLine, *config); err != nil {
+			fmt.Fprintln(os.Stderr, "Error in config:", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *mirrors != "" {
+		urls, err := readMirrors(*mirrors)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading mirrors:", err)
+			os.Exit(exitFailure)
+		}
+		opts.URLs = append(opts.URLs, urls...)
+	}
+	if opts.Auth.URL != "" && len(opts.URLs) > 0 {
+		fmt.Fprintln(os.Stderr, "-auth-request supplies the URL, it can't be combined with -url or -mirrors")
+		os.Exit(exitUsage)
+	}
+	if len(opts.URLs) == 0 && opts.Auth.URL == "" {
+		opts.URLs = []string{defaultURL}
+	}
 
-	file, err := os.Create("Xray-linux-64.zip")
-	if err != nil {
-		fmt.Println("Error crating file: ", err)
-		return
+	if (*head || *bench) && opts.Auth.URL != "" {
+		url, err := resolveAuthURL(context.Background(), opts.Auth, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		opts.URLs = []string{url}
 	}
-	defer file.Close()
 
-	// Get the content length of the file
-	contentLength, err := strconv.ParseInt(res.Header["Content-Length"][0], 10, 64)
-	if err != nil {
-		fmt.Println("Error getting content length: ", err)
+	if *bench {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := runBenchmark(ctx, opts, benchBytes, *benchTime, *jsonOut)
+		stop()
+		os.Exit(code)
+	}
+
+	if *head {
+		failed := false
+		for _, url := range opts.URLs {
+			probe, err := Probe(context.Background(), url, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error %s: %v\n", url, err)
+				failed = true
+				continue
+			}
+			if *jsonOut {
+				json.NewEncoder(os.Stdout).Encode(probe)
+			} else {
+				printProbe(os.Stdout, probe)
+			}
+		}
+		if failed {
+			os.Exit(exitFailure)
+		}
 		return
 	}
 
-	// Create a progress bar channel
-	progressChan := make(chan int64)
+	if opts.Insecure {
+		fmt.Fprintln(os.Stderr, "WARNING: -insecure is set, TLS certificates are NOT verified. Anyone on the network can tamper with this download.")
+	}
 
-	// Start a goroutine to update the progress bar
-	go func() {
-		var totalDownloaded int64
-		for {
-			select {
-			case bytes := <-progressChan:
-				totalDownloaded += bytes
-				percent := float64(totalDownloaded) / float64(contentLength) * 100
-				fmt.Printf("Progress: %.2f%% \r", percent)
-			}
+	if *metricsAddr != "" {
+		metrics := newPromMetrics()
+		if err := serveMetrics(*metricsAddr, metrics); err != nil {
+			fmt.Fprintln(os.Stderr, "Error serving metrics:", err)
+			os.Exit(exitFailure)
 		}
-	}()
+		opts.Metrics = metrics
+	}
+
+	os.Exit(runDownload(opts, *sumsURL, *logFile, *jsonOut))
+}
 
-	progressWriter := &progressWriter{progressChan: progressChan}
+// runDownload downloads opts.URLs, or the URL returned by opts.Auth, first
+// looking the checksum up in the manifest at sumsURL if one is given, and
+// returns the exit code. With a logFile each phase is also logged there as
+// JSON.
+func runDownload(opts options, sumsURL, logFile string, jsonOut bool) int {
+	// Ctrl-C or SIGTERM cancels the download instead of killing it midway
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Copy the response body to the file, updating the progress bar
-	_, err = io.Copy(file, io.TeeReader(res.Body, progressWriter))
+	log, closeLog, err := openLog(logFile)
 	if err != nil {
-		fmt.Println("Error writing file: ", err)
-		return
+		printError(opts, err)
+		return exitFailure
+	}
+	defer closeLog()
+	opts.Log = log
+	// The log file takes the place of the progress bar
+	opts.NoProgress = logFile != "" && logFile != "-"
+	if opts.Auth.URL != "" {
+		url, err := resolveAuthURL(ctx, opts.Auth, opts)
+		if err != nil {
+			printError(opts, err)
+			return exitFailure
+		}
+		opts.URLs = []string{url}
+	}
+	start := time.Now()
+	log.Info("start", "url", redactURL(opts.URLs[0]), "output", opts.Output, "urls", len(opts.URLs))
+	logDone := func(result DownloadResult, status string, err error) {
+		attrs := []any{"url", redactURL(result.FinalURL), "bytes", result.BytesWritten,
+			"duration_seconds", time.Since(start).Seconds(), "retries", result.Retries, "status", status}
+		if err != nil {
+			log.Error("done", append(attrs, "error", err.Error())...)
+			return
+		}
+		log.Info("done", attrs...)
+	}
+
+	if sumsURL != "" {
+		sums, err := fetchSums(ctx, sumsURL, opts)
+		if err != nil {
+			logDone(DownloadResult{}, "failed", err)
+			printError(opts, err)
+			return exitFailure
+		}
+		opts.Checksum, err = lookupSum(sums, opts.URLs[0])
+		if err != nil {
+			logDone(DownloadResult{}, "failed", err)
+			printError(opts, err)
+			return exitVerifyFailed
+		}
+	}
+
+	if _, err := checksumAlgo(opts); err != nil {
+		logDone(DownloadResult{}, "failed", err)
+		printError(opts, err)
+		return exitUsage
+	}
+
+	result, err := Download(ctx, opts)
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		logDone(result, "interrupted", err)
+	case errors.Is(err, ErrChecksumMismatch):
+		logDone(result, "checksum_mismatch", err)
+	case err != nil:
+		logDone(result, "failed", err)
+	default:
+		logDone(result, "ok", nil)
+	}
+	if errors.Is(err, ErrInterrupted) {
+		fmt.Fprintf(os.Stderr, "Interrupted after %d bytes\n", result.BytesWritten)
+		if opts.KeepPartial {
+			fmt.Fprintln(os.Stderr, "Partial file kept, run again to resume")
+		}
+		return exitInterrupted
+	}
+	if errors.Is(err, ErrChecksumMismatch) {
+		printError(opts, err)
+		return exitVerifyFailed
+	}
+	if err != nil {
+		printError(opts, err)
+		return exitFailure
 	}
 
-	fmt.Println("File downloaded successfully")
+	if jsonOut {
+		// Keep stdout clean for the file when it is being piped
+		out := os.Stdout
+		if opts.Output == "-" {
+			out = os.Stderr
+		}
+		json.NewEncoder(out).Encode(struct {
+			DownloadResult
+			Duration   float64 `json:"duration_seconds"`
+			Throughput float64 `json:"throughput_bytes_per_second"`
+		}{result, result.Duration.Seconds(), result.Throughput()})
+	}
+	return 0
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives events from Download. The default nopMetrics does
+// nothing, so there is no cost unless -metrics-addr is set.
+type Metrics interface {
+	DownloadStarted()
+	BytesTransferred(n int64)
+	Retry()
+	DownloadFailed()
+	DownloadFinished(d time.Duration)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) DownloadStarted()               {}
+func (nopMetrics) BytesTransferred(int64)         {}
+func (nopMetrics) Retry()                         {}
+func (nopMetrics) DownloadFailed()                {}
+func (nopMetrics) DownloadFinished(time.Duration) {}
+
+// durationBuckets are the upper bounds in seconds of the duration histogram.
+var durationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 3600}
+
+// promMetrics keeps the counters in memory and serves them in the
+// Prometheus text format.
+type promMetrics struct {
+	downloads atomic.Int64
+	bytes     atomic.Int64
+	retries   atomic.Int64
+	failures  atomic.Int64
+
+	mu      sync.Mutex
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newPromMetrics() *promMetrics {
+	return &promMetrics{buckets: make([]uint64, len(durationBuckets))}
+}
+
+func (m *promMetrics) DownloadStarted()         { m.downloads.Add(1) }
+func (m *promMetrics) BytesTransferred(n int64) { m.bytes.Add(n) }
+func (m *promMetrics) Retry()                   { m.retries.Add(1) }
+func (m *promMetrics) DownloadFailed()          { m.failures.Add(1) }
+
+func (m *promMetrics) DownloadFinished(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, le := range durationBuckets {
+		if d.Seconds() <= le {
+			m.buckets[i]++
+		}
+	}
+	m.sum += d.Seconds()
+	m.count++
+}
+
+func (m *promMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	counter := func(name, help string, v int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	counter("downloader_downloads_total", "Downloads started.", m.downloads.Load())
+	counter("downloader_bytes_total", "Bytes received.", m.bytes.Load())
+	counter("downloader_retries_total", "Attempts retried, including mirror fallbacks.", m.retries.Load())
+	counter("downloader_failures_total", "Downloads that failed.", m.failures.Load())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := "downloader_download_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Duration of successful downloads.\n# TYPE %s histogram\n", name, name)
+	for i, le := range durationBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, le, m.buckets[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, m.count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, m.sum, name, m.count)
+}
+
+// serveMetrics starts the /metrics endpoint in the background.
+func serveMetrics(addr string, m *promMetrics) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	server := &http.Server{Addr: addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() { errc <- server.ListenAndServe() }()
+	// Give a bad address a moment to fail so we can report it
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
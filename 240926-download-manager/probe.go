@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ProbeResult is what the server tells us about a file without downloading it.
+type ProbeResult struct {
+	URL           string `json:"url"`
+	ContentLength int64  `json:"content_length"`
+	AcceptRanges  bool   `json:"accept_ranges"`
+	Filename      string `json:"filename,omitempty"`
+	ETag          string `json:"etag,omitempty"`
+	LastModified  string `json:"last_modified,omitempty"`
+	ContentType   string `json:"content_type,omitempty"`
+	Protocol      string `json:"protocol"`
+}
+
+// Probe asks the server about url with a HEAD request. Servers that refuse
+// HEAD get a GET for the first byte instead, which tells us the same things.
+func Probe(ctx context.Context, url string, opts options) (ProbeResult, error) {
+	client, err := clientFor(url, opts)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+
+	res, err := probeRequest(ctx, client, http.MethodHead, url, opts)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	if res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented {
+		res, err = probeRequest(ctx, client, http.MethodGet, url, opts)
+		if err != nil {
+			return ProbeResult{}, err
+		}
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		return ProbeResult{}, fmt.Errorf("probing file: %s", res.Status)
+	}
+	return probeResponse(res), nil
+}
+
+// probeResponse reads what the headers of res, a 200 or 206, say about the
+// file.
+func probeResponse(res *http.Response) ProbeResult {
+	result := ProbeResult{
+		URL:           res.Request.URL.String(),
+		ContentLength: res.ContentLength,
+		AcceptRanges:  res.Header.Get("Accept-Ranges") == "bytes",
+		ETag:          res.Header.Get("ETag"),
+		LastModified:  res.Header.Get("Last-Modified"),
+		ContentType:   res.Header.Get("Content-Type"),
+		Protocol:      res.Proto,
+	}
+	// A ranged answer carries the full size in Content-Range: bytes 0-0/1234
+	if res.StatusCode == http.StatusPartialContent {
+		result.AcceptRanges = true
+		if _, total, ok := strings.Cut(res.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				result.ContentLength = size
+			}
+		}
+	}
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		result.Filename = params["filename"]
+	}
+	return result
+}
+
+func probeRequest(ctx context.Context, client *http.Client, method, url string, opts options) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header = opts.Headers.Clone()
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching URL: %w", err)
+	}
+	// Only the headers are needed
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1))
+	res.Body.Close()
+	return res, nil
+}
+
+func printProbe(w io.Writer, p ProbeResult) {
+	size := "unknown"
+	if p.ContentLength >= 0 {
+		size = strconv.FormatInt(p.ContentLength, 10) + " bytes"
+	}
+	fmt.Fprintln(w, "URL:          ", p.URL)
+	fmt.Fprintln(w, "Size:         ", size)
+	fmt.Fprintln(w, "Resumable:    ", p.AcceptRanges)
+	fmt.Fprintln(w, "Protocol:     ", p.Protocol)
+	if p.Filename != "" {
+		fmt.Fprintln(w, "Filename:     ", p.Filename)
+	}
+	if p.ETag != "" {
+		fmt.Fprintln(w, "ETag:         ", p.ETag)
+	}
+	if p.LastModified != "" {
+		fmt.Fprintln(w, "Last-Modified:", p.LastModified)
+	}
+	if p.ContentType != "" {
+		fmt.Fprintln(w, "Content-Type: ", p.ContentType)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shafiqsaaidin/go-project/term"
+)
+
+const (
+	// redrawInterval limits how often the bar is redrawn on a terminal
+	redrawInterval = 100 * time.Millisecond
+	// logInterval is how often a progress line is printed when not on a terminal
+	logInterval = 5 * time.Second
+)
+
+// ProgressAggregator counts downloaded bytes. Add is a single atomic
+// operation, so any number of goroutines can report to it without waiting
+// on each other or on whoever draws the progress.
+type ProgressAggregator struct {
+	total atomic.Int64
+	from  int64
+	start time.Time
+}
+
+// ProgressSnapshot is the progress at one point in time.
+type ProgressSnapshot struct {
+	// Total counts the bytes from the start of the file, including any that
+	// were already there when the download resumed
+	Total int64
+	// Rate is the average bytes per second since the aggregator was made
+	Rate float64
+}
+
+// NewProgressAggregator returns an aggregator whose count starts at from.
+func NewProgressAggregator(from int64) *ProgressAggregator {
+	p := &ProgressAggregator{from: from, start: time.Now()}
+	p.total.Store(from)
+	return p
+}
+
+// Add records n more bytes.
+func (p *ProgressAggregator) Add(n int64) { p.total.Add(n) }
+
+// Write records len(b) bytes, so the aggregator can sit in an io.TeeReader.
+func (p *ProgressAggregator) Write(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Snapshot returns the current total and rate.
+func (p *ProgressAggregator) Snapshot() ProgressSnapshot {
+	s := ProgressSnapshot{Total: p.total.Load()}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		s.Rate = float64(s.Total-p.from) / elapsed
+	}
+	return s
+}
+
+// startProgress starts a goroutine that prints the progress counted by the
+// returned aggregator. downloaded is where the count starts, so a resumed or
+// retried download carries on from the bytes already on disk instead of
+// starting the bar over; total is the full size or -1 when unknown. A non-zero
+// retry is shown next to the progress. Call stop once the copy is done; it
+// waits for the last line to be printed.
+func startProgress(logOut io.Writer, downloaded, total int64, retry int, metrics Metrics) (progress *ProgressAggregator, stop func()) {
+	progress = NewProgressAggregator(downloaded)
+	bar := newProgressBar(logOut, total)
+	if retry > 0 {
+		bar.note = fmt.Sprintf(" (retry %d)", retry)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(redrawInterval)
+		defer ticker.Stop()
+		reported := downloaded
+		report := func(final bool) {
+			s := progress.Snapshot()
+			if s.Total > reported {
+				metrics.BytesTransferred(s.Total - reported)
+				reported = s.Total
+			}
+			bar.update(s, final)
+		}
+		for {
+			select {
+			case <-ticker.C:
+				report(false)
+			case <-done:
+				report(true)
+				return
+			}
+		}
+	}()
+
+	return progress, func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// progressBar draws "[####----] 45% 12.3MB/23.1MB 5.2MB/s ETA 00:04" in
+// place on a terminal, and prints a plain line every few seconds otherwise
+// so logs don't fill up with control characters.
+type progressBar struct {
+	line     *term.Line
+	total    int64
+	note     string
+	lastDraw time.Time
+}
+
+func newProgressBar(out io.Writer, total int64) *progressBar {
+	return &progressBar{line: term.NewLine(out), total: total}
+}
+
+func (b *progressBar) update(s ProgressSnapshot, final bool) {
+	now := time.Now()
+	interval := logInterval
+	if b.line.TTY() {
+		interval = redrawInterval
+	}
+	if !final && now.Sub(b.lastDraw) < interval {
+		return
+	}
+	b.lastDraw = now
+	downloaded, rate := s.Total, s.Rate
+
+	if !b.line.TTY() {
+		line := "Downloaded " + humanBytes(downloaded)
+		if b.total >= 0 {
+			line += fmt.Sprintf("/%s (%.0f%%)", humanBytes(b.total), b.percent(downloaded))
+		}
+		b.line.Set(fmt.Sprintf("%s at %s/s%s", line, humanBytes(int64(rate)), b.note))
+		return
+	}
+
+	var line string
+	if b.total >= 0 {
+		eta := "--:--"
+		if rate > 0 {
+			eta = formatETA(time.Duration(float64(b.total-downloaded) / rate * float64(time.Second)))
+		}
+		info := fmt.Sprintf(" %3.0f%% %s/%s %s/s ETA %s%s", b.percent(downloaded),
+			humanBytes(downloaded), humanBytes(b.total), humanBytes(int64(rate)), eta, b.note)
+		barWidth := max(b.line.Width()-len(info)-3, 10)
+		filled := int(float64(barWidth) * b.percent(downloaded) / 100)
+		filled = min(max(filled, 0), barWidth)
+		line = "[" + strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled) + "]" + info
+	} else {
+		line = fmt.Sprintf("Downloaded %s %s/s%s", humanBytes(downloaded), humanBytes(int64(rate)), b.note)
+	}
+	b.line.Set(line)
+	if final {
+		b.line.Done()
+	}
+}
+
+// percent returns how much of the file is done. An empty file is complete
+// from the start, and an unknown size reports 0 rather than dividing by it.
+func (b *progressBar) percent(downloaded int64) float64 {
+	switch {
+	case b.total == 0:
+		return 100
+	case b.total < 0:
+		return 0
+	}
+	return float64(downloaded) / float64(b.total) * 100
+}
+
+// humanBytes formats n as 12.3MB.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n), "KMGTPE"
+	i := -1
+	for value >= unit && i < len(suffix)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%cB", value, suffix[i])
+}
+
+// formatETA formats d as mm:ss, or hh:mm:ss for an hour or more.
+func formatETA(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
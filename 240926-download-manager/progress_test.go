@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProgressPercent(t *testing.T) {
+	tests := []struct {
+		total, downloaded int64
+		want              float64
+	}{
+		{0, 0, 100},
+		{-1, 0, 0},
+		{-1, 12345, 0},
+		{1, 0, 0},
+		{1, 1, 100},
+		{200, 50, 25},
+	}
+	for _, tt := range tests {
+		bar := &progressBar{total: tt.total}
+		if got := bar.percent(tt.downloaded); got != tt.want {
+			t.Errorf("percent(%d of %d) = %v, want %v", tt.downloaded, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		total, downloaded int64
+		want              string
+	}{
+		{0, 0, "Downloaded 0B/0B (100%)"},
+		{1, 1, "Downloaded 1B/1B (100%)"},
+		{-1, 2048, "Downloaded 2.0KB at"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		bar := newProgressBar(&out, tt.total)
+		bar.update(ProgressSnapshot{Total: tt.downloaded}, true)
+		if !strings.HasPrefix(out.String(), tt.want) || strings.Contains(out.String(), "NaN") {
+			t.Errorf("progress of %d/%d = %q, want %q...", tt.downloaded, tt.total, out.String(), tt.want)
+		}
+	}
+}
+
+func TestProgressAggregatorConcurrent(t *testing.T) {
+	p := NewProgressAggregator(100)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				p.Add(2)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := p.Snapshot().Total; got != 100+8*1000*2 {
+		t.Errorf("Total = %d, want %d", got, 100+8*1000*2)
+	}
+}
+
+// BenchmarkProgressAggregator has every goroutine report 32KB writes, as
+// the chunk workers do, while one reader takes snapshots like the progress
+// goroutine.
+func BenchmarkProgressAggregator(b *testing.B) {
+	for _, perCPU := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("writers-per-cpu=%d", perCPU), func(b *testing.B) {
+			p := NewProgressAggregator(0)
+			done := make(chan struct{})
+			go func() {
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						p.Snapshot()
+					}
+				}
+			}()
+			defer close(done)
+			b.SetParallelism(perCPU)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					p.Add(32 << 10)
+				}
+			})
+		})
+	}
+}
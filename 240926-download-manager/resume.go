@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resumeState is kept next to the .part file so an interrupted download can
+// continue from where it stopped, but only if the file on the server is
+// still the same one.
+type resumeState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Decoded is set when the .part holds the decoded bytes of a compressed
+	// response, which can't be continued with a byte range.
+	Decoded bool `json:"decoded,omitempty"`
+
+	// HashState is the internal state of the HashAlgo checksum after the
+	// first HashOffset bytes of the .part, saved when an attempt fails so
+	// the resume carries on hashing from there, see resumeHash.
+	HashAlgo   string `json:"hash_algo,omitempty"`
+	HashState  []byte `json:"hash_state,omitempty"`
+	HashOffset int64  `json:"hash_offset,omitempty"`
+
+	// Size and Chunks are set for a parallel download, where the .part file
+	// has its full size from the start and each chunk tracks its own progress.
+	Size   int64        `json:"size,omitempty"`
+	Chunks []chunkState `json:"chunks,omitempty"`
+}
+
+// chunkState is the byte range [Start, End] of one parallel connection, of
+// which the first Done bytes are on disk.
+type chunkState struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+func (c chunkState) complete() bool { return c.Start+c.Done > c.End }
+
+func partPath(output string) string  { return output + ".part" }
+func statePath(output string) string { return output + ".part.json" }
+func lockPath(output string) string  { return output + ".lock" }
+
+// validator returns the value to send in If-Range. Weak ETags are not
+// allowed there, so Last-Modified is used instead.
+func (s resumeState) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+// loadResume returns the saved state and the size of the .part file. The
+// offset is zero when there is nothing that can safely be resumed.
+func loadResume(output string) (resumeState, int64) {
+	var state resumeState
+	data, err := os.ReadFile(statePath(output))
+	if err != nil || json.Unmarshal(data, &state) != nil {
+		return resumeState{}, 0
+	}
+	// A parallel download's part has holes, its size says nothing
+	info, err := os.Stat(partPath(output))
+	if err != nil || state.Decoded || state.validator() == "" || len(state.Chunks) > 0 {
+		return resumeState{}, 0
+	}
+	return state, info.Size()
+}
+
+func saveResume(output string, state resumeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(output), data, 0644)
+}
+
+// clearResume removes the .part file and its state.
+func clearResume(output string) {
+	os.Remove(partPath(output))
+	os.Remove(statePath(output))
+}
+
+// rangeStart returns the first byte of a "bytes 100-199/200" Content-Range.
+func rangeStart(contentRange string) (int64, error) {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	start, _, ok2 := strings.Cut(spec, "-")
+	if !ok || !ok2 {
+		return 0, fmt.Errorf("bad Content-Range %q", contentRange)
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
+
+// saveHashState records h, which has seen the first n bytes of the .part,
+// in state. Hashes that can't be serialized are left out, the resume then
+// reads the whole .part back instead.
+func saveHashState(state *resumeState, h hash.Hash, algo string, n int64) {
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return
+	}
+	state.HashAlgo, state.HashState, state.HashOffset = algo, data, n
+}
+
+// resumeHash brings h up to the first size bytes of the .part at name. With
+// a usable saved state only the bytes after state.HashOffset are read;
+// otherwise the whole .part is hashed again. Reading less is much faster for
+// a big file on slow storage, but the resumed bytes are then trusted as they
+// were hashed when they arrived: if the .part was damaged on disk since, the
+// checksum doesn't notice.
+func resumeHash(h hash.Hash, state resumeState, algo, name string, size int64) error {
+	m, ok := h.(encoding.BinaryUnmarshaler)
+	if ok && state.HashAlgo == algo && len(state.HashState) > 0 && state.HashOffset <= size {
+		if err := m.UnmarshalBinary(state.HashState); err == nil {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(h, io.NewSectionReader(f, state.HashOffset, size-state.HashOffset))
+			return err
+		}
+		h.Reset()
+	}
+	return hashFile(h, name)
+}
+
+// countingWriter passes writes on to w and counts the bytes it took.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// hashFile feeds the contents of name into h.
+func hashFile(h hash.Hash, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResumeCorruptPart(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	half := len(content) / 2
+
+	// The hash of the good first half, as an earlier attempt would have saved
+	good := resumeState{URL: "x", ETag: `"v1"`}
+	h := sha256.New()
+	h.Write(content[:half])
+	saveHashState(&good, h, "sha256", int64(half))
+
+	tests := []struct {
+		name  string
+		state resumeState
+		trust bool
+		// With -trust-part-hash the saved state vouches for the damaged
+		// bytes, so the resume goes through without a second request
+		wantRequests int32
+	}{
+		{"no saved hash", resumeState{URL: "x", ETag: `"v1"`}, false, 2},
+		{"saved hash", good, false, 2},
+		{"saved hash with -trust-part-hash", good, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("ETag", `"v1"`)
+				http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+			}))
+			defer srv.Close()
+
+			output := filepath.Join(t.TempDir(), "file.bin")
+			corrupt := bytes.Clone(content[:half])
+			copy(corrupt[100:], "garbage")
+			if err := os.WriteFile(partPath(output), corrupt, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := saveResume(output, tt.state); err != nil {
+				t.Fatal(err)
+			}
+
+			opts := testOptions(srv.URL+"/file.bin", output)
+			opts.Checksum = hex.EncodeToString(sum[:])
+			opts.TrustPartHash = tt.trust
+			if _, err := Download(context.Background(), opts); err != nil {
+				t.Fatal(err)
+			}
+			// One resume that fails the checksum, one download from scratch
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("%d requests, want %d", n, tt.wantRequests)
+			}
+			if data, _ := os.ReadFile(output); tt.wantRequests == 2 && !bytes.Equal(data, content) {
+				t.Error("file doesn't match the server's copy")
+			}
+		})
+	}
+}
+
+func TestRangeStart(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"bytes 0-99/200", 0, false},
+		{"bytes 100-199/200", 100, false},
+		{"bytes 100-199/*", 100, false},
+		{"", 0, true},
+		{"bytes */200", 0, true},
+		{"items 0-9/10", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := rangeStart(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("rangeStart(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStalled means no data arrived for the whole -stall-timeout. The attempt
+// is retried like any other failure.
+var ErrStalled = errors.New("download stalled")
+
+// stallTimer cancels a download when no data has arrived for a while. It is
+// an io.Writer so it can sit next to the progress counter; every write
+// restarts the clock. A nil stallTimer does nothing.
+type stallTimer struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+// withStallTimeout returns a context that is cancelled with ErrStalled once
+// nothing has been written to the returned timer for timeout. The clock
+// starts right away, so waiting for the response headers counts as well.
+// A timeout of zero disables the check. Call stop when the attempt is over.
+func withStallTimeout(ctx context.Context, timeout time.Duration) (stallCtx context.Context, t *stallTimer, stop func()) {
+	if timeout <= 0 {
+		return ctx, nil, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	t = &stallTimer{timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() { cancel(ErrStalled) })
+	return ctx, t, func() {
+		t.timer.Stop()
+		cancel(nil)
+	}
+}
+
+func (t *stallTimer) Write(b []byte) (int, error) {
+	if t != nil && len(b) > 0 {
+		t.timer.Reset(t.timeout)
+	}
+	return len(b), nil
+}
+
+// stallError replaces the context error of an attempt that stalled with one
+// saying so.
+func stallError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), ErrStalled) {
+		return fmt.Errorf("%w: no data for %s", ErrStalled, timeout)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStallTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		wantErr error
+	}{
+		{"stall is retried", 1, nil},
+		{"stall without retries fails", 0, ErrStalled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "10")
+				if requests.Add(1) == 1 {
+					// Headers and a few bytes, then nothing
+					w.Write([]byte("hal"))
+					w.(http.Flusher).Flush()
+					select {
+					case <-r.Context().Done():
+					case <-time.After(5 * time.Second):
+					}
+					return
+				}
+				w.Write([]byte("whole file"))
+			}))
+			defer srv.Close()
+
+			output := filepath.Join(t.TempDir(), "file.txt")
+			opts := testOptions(srv.URL+"/file.txt", output)
+			opts.StallTimeout, opts.Retries = 200*time.Millisecond, tt.retries
+			start := time.Now()
+			_, err := Download(context.Background(), opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Download error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if elapsed := time.Since(start); elapsed > 2*time.Second {
+					t.Errorf("stall noticed after %s", elapsed)
+				}
+				return
+			}
+			if data, _ := os.ReadFile(output); string(data) != "whole file" {
+				t.Errorf("file has %q", data)
+			}
+		})
+	}
+}
+
+func TestStallTimerOff(t *testing.T) {
+	ctx, timer, stop := withStallTimeout(context.Background(), 0)
+	defer stop()
+	if timer != nil || ctx != context.Background() {
+		t.Error("a zero timeout set up a stall timer")
+	}
+	// A nil timer still takes writes, so callers needn't check
+	if n, err := timer.Write([]byte("abc")); n != 3 || err != nil {
+		t.Errorf("nil timer Write = %d, %v", n, err)
+	}
+}
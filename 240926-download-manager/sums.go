@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var bsdSumLine = regexp.MustCompile(`^[A-Za-z0-9-]+ \((.+)\) = ([0-9a-fA-F]+)$`)
+
+// maxSumsSize caps how much of a checksum manifest is read.
+const maxSumsSize = 1 << 20
+
+// fetchSums downloads a SHA256SUMS style manifest and returns the digests by
+// file name.
+func fetchSums(ctx context.Context, sumsURL string, opts options) (map[string]string, error) {
+	client, err := clientFor(sumsURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sumsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header = opts.Headers.Clone()
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching checksums: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching checksums: %s", res.Status)
+	}
+	return parseSums(io.LimitReader(res.Body, maxSumsSize))
+}
+
+// parseSums reads "<hash>  <filename>" lines as written by sha256sum and
+// friends, and the BSD style "SHA512 (filename) = <hash>" lines of
+// shasum --tag. A '*' before the name (binary mode) is dropped. The algorithm
+// is told from the digest length later on.
+func parseSums(r io.Reader) (map[string]string, error) {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := bsdSumLine.FindStringSubmatch(line); m != nil {
+			sums[m[1]] = strings.ToLower(m[2])
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		name := strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		sums[name] = strings.ToLower(fields[0])
+	}
+	return sums, scanner.Err()
+}
+
+// lookupSum finds the digest for the file at rawURL, matching on its base name.
+func lookupSum(sums map[string]string, rawURL string) (string, error) {
+	name := path.Base(strings.SplitN(rawURL, "?", 2)[0])
+	if sum, ok := sums[name]; ok {
+		return sum, nil
+	}
+	// Some manifests list paths like ./dist/name
+	for file, sum := range sums {
+		if path.Base(file) == name {
+			return sum, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not listed in the checksum manifest", name)
+}
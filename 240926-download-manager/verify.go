@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runVerify checks a file that is already on disk against a checksum, given
+// directly or looked up in a -sums manifest, without downloading it. It
+// returns 0 on a match and exitVerifyFailed on a mismatch.
+func runVerify(args []string) int {
+	opts := options{Headers: http.Header{}, MaxRedirects: 10}
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Func("sha256", "Expected SHA-256 checksum of the file (hex), same as -checksum with -algo sha256", func(s string) error {
+		opts.Checksum, opts.HashAlgo = s, "sha256"
+		return nil
+	})
+	fs.StringVar(&opts.Checksum, "checksum", "", "Expected checksum of the file (hex), see -algo")
+	fs.StringVar(&opts.HashAlgo, "algo", "", "Checksum algorithm: sha256, sha512, sha1 or md5 (default: from the digest length)")
+	fs.BoolVar(&opts.AllowWeakHash, "allow-weak-hash", false, "Accept sha1 and md5 checksums")
+	sumsURL := fs.String("sums", "", "URL of a SHA256SUMS manifest listing the file")
+	fs.Var(headerFlag(opts.Headers), "header", "Extra request header for -sums \"Key: Value\" (repeatable)")
+	fs.StringVar(&opts.Proxy, "proxy", "", "Proxy URL; default from HTTP_PROXY/NO_PROXY")
+	fs.StringVar(&opts.CACert, "cacert", "", "PEM file with extra CA certificates to trust")
+	fs.BoolVar(&opts.Quiet, "quiet", false, "Only print errors")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "Don't color the result even on a terminal")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: verify FILE -sha256 DIGEST | -checksum DIGEST | -sums URL")
+		fs.PrintDefaults()
+	}
+	// Flags may come before or after the file name
+	fs.Parse(args)
+	var files []string
+	for fs.NArg() > 0 {
+		files = append(files, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+
+	if len(files) != 1 || (opts.Checksum == "") == (*sumsURL == "") {
+		fs.Usage()
+		return exitUsage
+	}
+	file := files[0]
+
+	if *sumsURL != "" {
+		sums, err := fetchSums(context.Background(), *sumsURL, opts)
+		if err != nil {
+			printError(opts, err)
+			return exitFailure
+		}
+		if opts.Checksum, err = lookupSum(sums, filepath.ToSlash(file)); err != nil {
+			printError(opts, err)
+			return exitVerifyFailed
+		}
+	}
+	algo, err := checksumAlgo(opts)
+	if err != nil {
+		printError(opts, err)
+		return exitUsage
+	}
+
+	// hashFile streams the file, so its size doesn't matter
+	hash := hashAlgos[algo]()
+	if err := hashFile(hash, file); err != nil {
+		printError(opts, err)
+		return exitFailure
+	}
+	got := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(got, opts.Checksum) {
+		printError(opts, fmt.Errorf("%w: %s: expected %s, got %s", ErrChecksumMismatch, file, opts.Checksum, got))
+		return exitVerifyFailed
+	}
+	if !opts.Quiet {
+		fmt.Println(paint(os.Stdout, opts.NoColor, colorGreen, fmt.Sprintf("%s: %s matches", file, algo)))
+	}
+	return 0
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Backup codes let a user in when their authenticator is lost. Each works
+// once. Only a SHA-256 of each code is kept in the store, so a code is shown
+// exactly once, when it is generated.
+const (
+	defaultBackupCodes = 10
+	backupCodeBytes    = 5 // 8 base32 characters, 40 bits
+)
+
+// BackupCode is one backup code of an account.
+type BackupCode struct {
+	Hash   string     `json:"hash"`
+	UsedAt *time.Time `json:"used_at,omitempty"`
+}
+
+// runBackupCodes manages the backup codes of a stored account and returns the
+// exit code:
+//
+//	backup-codes status NAME          counts, without revealing codes
+//	backup-codes regenerate NAME      replaces all codes with a fresh set
+//	backup-codes redeem NAME CODE     uses up one code
+func runBackupCodes(args []string) int {
+	usage := "usage: backup-codes status|regenerate|redeem [-store file] NAME [CODE]"
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return exitUsage
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("backup-codes "+action, flag.ExitOnError)
+	storePath := fs.String("store", "accounts.json", "Accounts file")
+	count := fs.Int("count", defaultBackupCodes, "Number of codes to generate")
+	fs.BoolVar(&quiet, "quiet", false, quietUsage)
+	fs.Parse(args[1:])
+
+	wantArgs := map[string]int{"status": 1, "regenerate": 1, "redeem": 2}[action]
+	if wantArgs == 0 || fs.NArg() != wantArgs {
+		fmt.Println(usage)
+		return exitUsage
+	}
+	if *count < 1 {
+		fmt.Println("Error: -count must be at least 1")
+		return exitUsage
+	}
+
+	// Hold the lock from load to save, so two redemptions of the same code
+	// can't both succeed
+	unlock, err := lockStore(*storePath)
+	if err != nil {
+		fmt.Println("Error locking store:", err)
+		return exitFailure
+	}
+	defer unlock()
+	store, err := LoadStore(*storePath)
+	if err != nil {
+		fmt.Println("Error loading store:", err)
+		return exitFailure
+	}
+	account, ok := store.Find(fs.Arg(0))
+	if !ok {
+		fmt.Printf("Error: no account %q in %s\n", fs.Arg(0), *storePath)
+		return exitUsage
+	}
+
+	switch action {
+	case "status":
+		used := 0
+		for _, c := range account.BackupCodes {
+			if c.UsedAt != nil {
+				used++
+			}
+		}
+		fmt.Printf("Total: %d\nUsed: %d\nRemaining: %d\n", len(account.BackupCodes), used, len(account.BackupCodes)-used)
+		return exitOK
+
+	case "regenerate":
+		codes, hashes, err := newBackupCodes(*count)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return exitFailure
+		}
+		account.BackupCodes = hashes
+		if err := store.Save(); err != nil {
+			fmt.Println("Error saving store:", err)
+			return exitFailure
+		}
+		infof("Generated %d backup codes for %s, the old ones no longer work.\n", len(codes), account.Name)
+		infoln("Store them safely, they are not shown again:")
+		for _, c := range codes {
+			fmt.Println(c)
+		}
+		return exitOK
+	}
+
+	hash := hashBackupCode(fs.Arg(1))
+	for i := range account.BackupCodes {
+		c := &account.BackupCodes[i]
+		if c.UsedAt == nil && subtle.ConstantTimeCompare([]byte(c.Hash), []byte(hash)) == 1 {
+			now := time.Now().UTC().Truncate(time.Second)
+			c.UsedAt = &now
+			if err := store.Save(); err != nil {
+				fmt.Println("Error saving store:", err)
+				return exitFailure
+			}
+			infoln("Valid backup code")
+			return exitOK
+		}
+	}
+	fmt.Println("Invalid or already used backup code!")
+	return exitInvalid
+}
+
+// newBackupCodes returns n random codes, formatted like ABCD-EFGH, and their
+// hashes for the store.
+func newBackupCodes(n int) ([]string, []BackupCode, error) {
+	codes := make([]string, n)
+	hashes := make([]BackupCode, n)
+	for i := range codes {
+		b := make([]byte, backupCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := base32.StdEncoding.EncodeToString(b)
+		codes[i] = s[:4] + "-" + s[4:]
+		hashes[i] = BackupCode{Hash: hashBackupCode(codes[i])}
+	}
+	return codes, hashes, nil
+}
+
+// hashBackupCode hashes a code as typed, ignoring case, spaces and dashes.
+func hashBackupCode(code string) string {
+	code = strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
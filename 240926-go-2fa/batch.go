@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// runValidateBatch validates every secret,passcode row of a CSV file and
+// returns the exit code.
+func runValidateBatch(args []string) int {
+	fs := flag.NewFlagSet("validate-batch", flag.ExitOnError)
+	digits := fs.Int("digits", 6, "Number of digits in a code")
+	periodFlag := fs.Uint("period", period, "Seconds a code is valid for")
+	skew := fs.Uint("skew", 1, "Periods before and after the current one to accept")
+	failOnInvalid := fs.Bool("fail-on-invalid", true, "Exit with 3 if any row is invalid, 1 if any was rate limited, 2 if any is malformed")
+	summaryFlag := fs.Bool("summary", false, "Finish with a summary: rows processed, succeeded, failed, skipped, time and reasons")
+	jsonOut := fs.Bool("json", false, "Print only the summary, as JSON")
+	rateLimit := fs.String("rate-limit", "5/30s", "Maximum validation attempts per secret, as attempts/window (0 to disable)")
+	rateState := fs.String("rate-state", "", "File to keep rate limit state in across runs")
+	fs.BoolVar(&quiet, "quiet", false, quietUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: validate-batch [flags] file.csv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *jsonOut {
+		quiet = true
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	limiter, err := newRateLimiter(*rateLimit, *rateState)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return exitUsage
+	}
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return exitUsage
+	}
+	defer file.Close()
+
+	opts := totp.ValidateOpts{
+		Period:    *periodFlag,
+		Skew:      *skew,
+		Digits:    otp.Digits(*digits),
+		Algorithm: otp.AlgorithmSHA1,
+	}
+	now := clockNow()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	var valid, invalid, limited int
+	var malformed []string
+	summary := newBatchSummary()
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			malformed = append(malformed, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		if len(record) != 2 {
+			malformed = append(malformed, fmt.Sprintf("row %d: expected secret,passcode, got %d fields", row, len(record)))
+			continue
+		}
+		secret, passcode := strings.TrimSpace(record[0]), normalizePasscode(record[1])
+		// Skip a header line
+		if row == 1 && strings.EqualFold(secret, "secret") {
+			continue
+		}
+
+		secret, err = normalizeSecret(secret)
+		if err != nil {
+			malformed = append(malformed, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		allowed, err := limiter.Allow(accountKey(Account{Secret: secret}))
+		if err != nil {
+			fmt.Println("Error saving rate limit state:", err)
+		}
+		if !allowed {
+			limited++
+			summary.fail(fmt.Sprintf("row %d: rate limited", row))
+			if !*jsonOut {
+				fmt.Printf("row %d: rate limited\n", row)
+			}
+			continue
+		}
+		ok, err := totp.ValidateCustom(passcode, secret, now, opts)
+		switch {
+		case err != nil && !errors.Is(err, otp.ErrValidateInputInvalidLength):
+			malformed = append(malformed, fmt.Sprintf("row %d: %v", row, err))
+		case ok:
+			valid++
+			summary.succeed()
+			infof("row %d: valid\n", row)
+		default:
+			invalid++
+			summary.fail(fmt.Sprintf("row %d: invalid", row))
+			if !*jsonOut {
+				fmt.Printf("row %d: invalid\n", row)
+			}
+		}
+	}
+
+	for _, m := range malformed {
+		summary.skip(m)
+		if !*jsonOut {
+			fmt.Println("Malformed", m)
+		}
+	}
+	infof("%d valid, %d invalid, %d rate limited, %d malformed\n", valid, invalid, limited, len(malformed))
+	if *summaryFlag || *jsonOut {
+		summary.print(*jsonOut)
+	}
+
+	switch {
+	case *failOnInvalid && invalid > 0:
+		return exitInvalid
+	case *failOnInvalid && limited > 0:
+		return exitFailure
+	case *failOnInvalid && len(malformed) > 0:
+		return exitUsage
+	}
+	return exitOK
+}
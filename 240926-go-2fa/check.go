@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// runCheck validates a passcode for a known secret, optionally at a fixed
+// time, and returns the exit code. It is meant for monitoring probes.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	secret := fs.String("secret", "", "Base32 TOTP secret (this or -account is required)")
+	accountName := fs.String("account", "", "Name of an account in the store to check against")
+	storePath := fs.String("store", "accounts.json", "Accounts file used with -account")
+	vaultPath := fs.String("vault", "", "Encrypted vault to use with -account instead of -store")
+	passphraseFile := fs.String("passphrase-file", "", "File holding the vault passphrase (default: $"+vaultPassphraseEnv+")")
+	passcode := fs.String("passcode", "", "Passcode to validate")
+	at := fs.String("at", "", "Validate at this RFC3339 time instead of now")
+	showCode := fs.Bool("show-code", false, "Print the code for the secret at that time")
+	diagnose := fs.Bool("diagnose", false, fmt.Sprintf("On an invalid code, check up to %d periods either side to tell a wrong code from a wrong clock", diagnoseSteps))
+	lockoutSpec := fs.String("lockout", "5/15m", "Lock the account after this many failed attempts within the window, for the window (0 to disable)")
+	lockoutState := fs.String("lockout-state", "", "File keeping failed attempts and lockouts across runs; enables -lockout")
+	rateLimit := fs.String("rate-limit", "5/30s", "Maximum validation attempts per account, as attempts/window (0 to disable)")
+	rateState := fs.String("rate-state", "", "File to keep rate limit state in across runs (default: next to the store with -account)")
+	fs.BoolVar(&quiet, "quiet", false, quietUsage)
+	fs.Parse(args)
+	*passcode = normalizePasscode(*passcode)
+
+	if (*secret == "") == (*accountName == "") || (*passcode == "" && !*showCode) {
+		fmt.Println("usage: check -secret SECRET | -account NAME [-store file | -vault file] [-passcode CODE] [-at RFC3339] [-show-code] [-rate-limit 5/30s]")
+		return exitUsage
+	}
+	limiter, err := newRateLimiter(*rateLimit, rateStatePath(*rateState, *accountName, *storePath, *vaultPath))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return exitUsage
+	}
+
+	t := clockNow()
+	if *at != "" {
+		t, err = time.Parse(time.RFC3339, *at)
+		if err != nil {
+			fmt.Println("Error: -at must be an RFC3339 time:", err)
+			return exitUsage
+		}
+	}
+
+	// A stored account brings its own parameters, and its previous secret
+	// while a rotation overlap lasts
+	account := Account{Secret: *secret}
+	if *accountName != "" {
+		var store *Store
+		if *vaultPath != "" {
+			var passphrase string
+			if passphrase, err = readPassphrase(*passphraseFile); err == nil {
+				store, err = LoadVault(*vaultPath, passphrase)
+			}
+		} else {
+			store, err = LoadStore(*storePath)
+		}
+		if err != nil {
+			fmt.Println("Error loading store:", err)
+			return exitFailure
+		}
+		found, ok := store.Find(*accountName)
+		if !ok {
+			fmt.Printf("Error: no account %q in %s\n", *accountName, store.path)
+			return exitUsage
+		}
+		account = *found
+	}
+	opts := account.validateOpts()
+	secrets := account.secrets(t)
+	for i, s := range secrets {
+		clean, err := normalizeSecret(s)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return exitUsage
+		}
+		secrets[i] = clean
+	}
+
+	if *showCode {
+		code, err := totp.GenerateCodeCustom(secrets[0], t, opts)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return exitUsage
+		}
+		fmt.Println("Code:", code)
+	}
+	if *passcode == "" {
+		return exitOK
+	}
+
+	// Held until the attempt is recorded, so parallel runs can't each get
+	// the last allowed attempt
+	lockKey := accountKey(account)
+	var lock *lockout
+	if *lockoutState != "" {
+		unlock, err := lockStore(*lockoutState)
+		if err != nil {
+			fmt.Println("Error locking lockout state:", err)
+			return exitFailure
+		}
+		defer unlock()
+		if lock, err = loadLockout(*lockoutSpec, *lockoutState); err != nil {
+			fmt.Println("Error:", err)
+			return exitUsage
+		}
+		if until, locked := lock.Locked(lockKey, time.Now()); locked {
+			fmt.Println("Locked out after too many failed attempts, try again after", until.Format(time.RFC3339))
+			return ValidationResult{Reason: ReasonLockedOut}.exitCode()
+		}
+	}
+
+	allowed, err := limiter.Allow(lockKey)
+	if err != nil {
+		fmt.Println("Error saving rate limit state:", err)
+	}
+	if !allowed {
+		fmt.Println("Rate limited, too many attempts. Try again later.")
+		return ValidationResult{Reason: ReasonRateLimited}.exitCode()
+	}
+
+	// Bad stored parameters, e.g. an unsupported digit count, are a usage
+	// error rather than a wrong code
+	if _, err := totp.GenerateCodeCustom(secrets[0], t, opts); err != nil {
+		fmt.Println("Error:", err)
+		return exitUsage
+	}
+	searchSteps := 0
+	if *diagnose {
+		searchSteps = diagnoseSteps
+	}
+	result := validateCode(*passcode, secrets, "", t, opts, searchSteps)
+	switch {
+	case result.Valid && result.Secret > 0:
+		infoln("Valid passcode (previous secret, re-enroll before", account.PreviousValidUntil.Format(time.RFC3339)+")")
+	case result.Valid:
+		infoln("Valid passcode")
+	default:
+		fmt.Println("Invalid passcode!")
+		if *diagnose {
+			// The result above stays as it is, this only explains it
+			fmt.Println("Diagnosis:", describeDiagnosis(result.SkewOffset, result.Reason == ReasonOutsideWindow))
+		}
+	}
+
+	if lock != nil {
+		var err error
+		locked := false
+		if result.Valid {
+			err = lock.Succeed(lockKey)
+		} else {
+			locked, err = lock.Fail(lockKey, time.Now())
+		}
+		if err != nil {
+			fmt.Println("Error saving lockout state:", err)
+		}
+		if locked {
+			fmt.Printf("Too many failed attempts, locked out for %s\n", lock.window)
+		}
+	}
+	return result.exitCode()
+}
+
+// rateStatePath is the rate limit state file for check: the one given, or
+// for a stored account one next to the store, so the limit holds across
+// runs against the same accounts.
+func rateStatePath(given, accountName, storePath, vaultPath string) string {
+	switch {
+	case given != "" || accountName == "":
+		return given
+	case vaultPath != "":
+		return vaultPath + ".ratelimit"
+	}
+	return storePath + ".ratelimit"
+}
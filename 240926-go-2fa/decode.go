@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pquerna/otp"
+)
+
+// runDecodeURI prints the fields of an otpauth:// URI, e.g. one read from a
+// user's QR code, and returns the exit code.
+func runDecodeURI(args []string) int {
+	fs := flag.NewFlagSet("decode-uri", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Println("usage: decode-uri 'otpauth://totp/Issuer:account?secret=...'")
+		return exitUsage
+	}
+	key, err := decodeURI(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return exitUsage
+	}
+
+	fmt.Println("Type:        ", key.Type())
+	fmt.Println("Issuer:      ", key.Issuer())
+	fmt.Println("Account Name:", key.AccountName())
+	fmt.Println("Secret:      ", key.Secret())
+	fmt.Println("Algorithm:   ", key.Algorithm())
+	fmt.Println("Digits:      ", key.Digits())
+	if key.Type() == "totp" {
+		fmt.Println("Period:      ", key.Period(), "seconds")
+	}
+	for _, w := range uriWarnings(key) {
+		fmt.Println("Warning:", w)
+	}
+	return exitOK
+}
+
+// decodeURI parses uri with otp.NewKeyFromURL, which accepts almost anything,
+// and checks that it really is a TOTP or HOTP URI with a usable secret.
+func decodeURI(uri string) (*otp.Key, error) {
+	key, err := otp.NewKeyFromURL(uri)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid URI: %w", err)
+	}
+	scheme, _, _ := strings.Cut(strings.TrimSpace(uri), ":")
+	if !strings.EqualFold(scheme, "otpauth") {
+		return nil, fmt.Errorf("URI scheme is %q, expected otpauth", scheme)
+	}
+	if key.Type() != "totp" && key.Type() != "hotp" {
+		return nil, fmt.Errorf("URI type is %q, expected totp or hotp", key.Type())
+	}
+	if key.Secret() == "" {
+		return nil, errors.New("URI has no secret parameter")
+	}
+	if _, err := normalizeSecret(key.Secret()); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// uriWarnings lists parameters the otp library falls back to a default for,
+// since an authenticator app may read them differently.
+func uriWarnings(key *otp.Key) []string {
+	var warnings []string
+	u, err := url.Parse(key.URL())
+	if err != nil {
+		return nil
+	}
+	q := u.Query()
+	if q.Has("algorithm") {
+		switch strings.ToLower(q.Get("algorithm")) {
+		case "sha1", "sha256", "sha512", "md5":
+		default:
+			warnings = append(warnings, fmt.Sprintf("unknown algorithm %q, SHA1 is assumed", q.Get("algorithm")))
+		}
+	}
+	if d := q.Get("digits"); q.Has("digits") && d != "6" && d != "8" {
+		warnings = append(warnings, fmt.Sprintf("digits=%s is not supported, 6 is assumed", d))
+	}
+	if p := q.Get("period"); q.Has("period") {
+		if n, err := strconv.ParseUint(p, 10, 64); err != nil || n == 0 {
+			warnings = append(warnings, fmt.Sprintf("period=%s is not a number of seconds, 30 is assumed", p))
+		}
+	}
+	if key.Issuer() == "" {
+		warnings = append(warnings, "no issuer, some apps only show the account name")
+	}
+	return warnings
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr string
+	}{
+		{"totp", "otpauth://totp/Example.com:alice?secret=JBSWY3DPEHPK3PXP&issuer=Example.com", ""},
+		{"hotp", "otpauth://hotp/Example.com:alice?secret=JBSWY3DPEHPK3PXP&counter=3", ""},
+		{"lowercase secret", "otpauth://totp/alice?secret=jbswy3dpehpk3pxp", ""},
+		{"wrong scheme", "https://totp/alice?secret=JBSWY3DPEHPK3PXP", "expected otpauth"},
+		{"wrong type", "otpauth://motp/alice?secret=JBSWY3DPEHPK3PXP", "expected totp or hotp"},
+		{"no secret", "otpauth://totp/alice?issuer=Example.com", "no secret"},
+		{"bad secret", "otpauth://totp/alice?secret=JBSWY3DPEHPK3PX1", "did you mean"},
+		{"short secret", "otpauth://totp/alice?secret=JBSWY3DP", "at least 16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := decodeURI(tt.uri)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeURI error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeURI: %v", err)
+			}
+			if key.AccountName() != "alice" {
+				t.Errorf("account = %q, want alice", key.AccountName())
+			}
+		})
+	}
+}
+
+func TestURIWarnings(t *testing.T) {
+	const base = "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP"
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"clean", "&issuer=Example.com&algorithm=SHA256&digits=8&period=60", nil},
+		{"no issuer", "", []string{"no issuer"}},
+		{"unknown algorithm", "&issuer=Example.com&algorithm=SHA3", []string{`unknown algorithm "SHA3"`}},
+		{"odd digits", "&issuer=Example.com&digits=7", []string{"digits=7"}},
+		{"bad period", "&issuer=Example.com&period=soon", []string{"period=soon"}},
+		{"zero period", "&issuer=Example.com&period=0", []string{"period=0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := decodeURI(base + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := uriWarnings(key)
+			if len(got) != len(tt.want) {
+				t.Fatalf("uriWarnings = %q, want %d warnings", got, len(tt.want))
+			}
+			for i := range got {
+				if !strings.Contains(got[i], tt.want[i]) {
+					t.Errorf("warning %q doesn't mention %q", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+const period = 30
+
+// diagnoseSteps is how many periods either side -diagnose searches.
+const diagnoseSteps = 5
+
+// matchStep looks for the time step, relative to t, that passcode was
+// generated for. It checks the current step first and then works outwards
+// up to maxSteps periods either side.
+func matchStep(passcode, secret, encoder string, t time.Time, maxSteps int) (int, bool) {
+	return scanSteps(t, maxSteps, period, func(at time.Time) bool {
+		return codeMatches(passcode, secret, encoder, at, Account{}.validateOpts())
+	})
+}
+
+// scanSteps returns the first step, working outwards from t, for which
+// matches is true.
+func scanSteps(t time.Time, maxSteps int, stepSeconds uint, matches func(time.Time) bool) (int, bool) {
+	for i := 0; i <= maxSteps; i++ {
+		for _, step := range []int{i, -i} {
+			at := t.Add(time.Duration(step) * time.Duration(stepSeconds) * time.Second)
+			if matches(at) {
+				return step, true
+			}
+			if i == 0 {
+				break
+			}
+		}
+	}
+	return 0, false
+}
+
+// describeDiagnosis explains the result of a wider scan for a rejected code,
+// telling a wrong code apart from a clock that is far off.
+func describeDiagnosis(step int, found bool) string {
+	if !found {
+		return fmt.Sprintf("no match within %d periods either side, the code is wrong", diagnoseSteps)
+	}
+	return fmt.Sprintf("the code matches at %s, outside the accepted window", describeDrift(step))
+}
+
+// codeMatches checks passcode against exactly one time step, without skew.
+// Steam codes ignore opts, they always have the same parameters.
+func codeMatches(passcode, secret, encoder string, at time.Time, opts totp.ValidateOpts) bool {
+	if encoder == "steam" {
+		code, err := steamCode(secret, at)
+		return err == nil && hmac.Equal([]byte(code), []byte(strings.ToUpper(passcode)))
+	}
+	opts.Skew = 0
+	ok, err := totp.ValidateCustom(passcode, secret, at, opts)
+	return err == nil && ok
+}
+
+// describeDrift explains what a matched step says about the authenticator's
+// clock. A code from a later step means its clock is ahead of ours.
+func describeDrift(step int) string {
+	if step == 0 {
+		return "clock in sync"
+	}
+	direction := "fast"
+	if step < 0 {
+		direction = "slow"
+	}
+	seconds := step * period
+	if seconds < 0 {
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%+d period, clock ~%ds %s", step, seconds, direction)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeStep returns the absolute TOTP time step the passcode was generated
+// for, accepting one period of skew around t.
+func timeStep(passcode, secret, encoder string, t time.Time) (int64, bool) {
+	step, ok := matchStep(passcode, secret, encoder, t, 1)
+	return t.Unix()/period + int64(step), ok
+}
+
+// confirmNextCode waits for the period after the one first was generated
+// in, asks for that code and checks it belongs to exactly the next time
+// step. Two codes in a row show the app's clock keeps time with ours,
+// rather than just landing inside the skew window once. The second code is
+// another guess, so it counts against limiter under limitKey like the first.
+// It returns whether the second code was right and, if not, why.
+func confirmNextCode(first, secret, encoder string, firstAt time.Time, limiter *rateLimiter, limitKey string) (bool, string) {
+	firstStep, _ := timeStep(first, secret, encoder, firstAt)
+	next := time.Unix((firstStep+1)*period, 0)
+	if wait := next.Sub(clockNow()); wait > 0 {
+		infof("Waiting %ds for the next code...\n", int(wait.Round(time.Second).Seconds()))
+		time.Sleep(wait)
+	}
+
+	second := prompForPasscode("Enter the next passcode: ")
+	allowed, err := limiter.Allow(limitKey)
+	if err != nil {
+		fmt.Println("Error saving rate limit state:", err)
+	}
+	if !allowed {
+		return false, "rate limited, too many attempts"
+	}
+	secondStep, ok := timeStep(second, secret, encoder, clockNow())
+	switch {
+	case !ok:
+		return false, "the second passcode is invalid"
+	case secondStep == firstStep:
+		return false, "the second passcode is the same code again, wait for it to change"
+	case secondStep != firstStep+1:
+		return false, fmt.Sprintf("the second passcode is %+d periods from the first, expected the next one", secondStep-firstStep)
+	}
+	return true, ""
+}
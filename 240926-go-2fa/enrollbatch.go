@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runEnrollBatch enrolls every issuer,account row of a CSV file: a secret is
+// generated per row, its QR code written to -out-dir and its otpauth URI to
+// the -uris CSV, or the account added to a vault with -vault. Bad rows are
+// skipped and reported at the end. It returns the exit code.
+func runEnrollBatch(args []string) int {
+	fs := flag.NewFlagSet("enroll-batch", flag.ExitOnError)
+	outDir := fs.String("out-dir", "qr-codes", "Directory for the QR code PNGs")
+	urisPath := fs.String("uris", "", "CSV file of name,otpauth URI to write (default: uris.csv in -out-dir)")
+	vaultPath := fs.String("vault", "", "Add the accounts to this encrypted vault instead of writing -uris")
+	passphraseFile := fs.String("passphrase-file", "", "File holding the vault passphrase (default: $"+vaultPassphraseEnv+")")
+	secretSize := fs.Uint("secret-size", defaultSecretSize, fmt.Sprintf("Secret size in bytes (%d-%d)", minSecretSize, maxSecretSize))
+	logo := fs.String("logo", "", "PNG logo to draw in the center of the QR codes")
+	force := fs.Bool("force", false, "Overwrite existing QR code and -uris files")
+	summaryFlag := fs.Bool("summary", false, "Finish with a summary: rows processed, succeeded, failed, skipped, time and reasons")
+	jsonOut := fs.Bool("json", false, "Print only the summary, as JSON")
+	fs.BoolVar(&quiet, "quiet", false, quietUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: enroll-batch [flags] users.csv")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *jsonOut {
+		quiet = true
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *secretSize < minSecretSize || *secretSize > maxSecretSize {
+		fmt.Printf("Error: secret size must be between %d and %d bytes, got %d\n", minSecretSize, maxSecretSize, *secretSize)
+		return exitUsage
+	}
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return exitUsage
+	}
+	defer file.Close()
+	if err := os.MkdirAll(*outDir, 0700); err != nil {
+		fmt.Println("Error:", err)
+		return exitFailure
+	}
+
+	// The secrets go either into the vault or, in the clear, into the URIs file
+	var store *Store
+	var uris *csv.Writer
+	if *vaultPath != "" {
+		passphrase, err := readPassphrase(*passphraseFile)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return exitUsage
+		}
+		unlock, err := lockStore(*vaultPath)
+		if err != nil {
+			fmt.Println("Error locking vault:", err)
+			return exitFailure
+		}
+		defer unlock()
+		store, err = LoadVault(*vaultPath, passphrase)
+		if errors.Is(err, os.ErrNotExist) {
+			store, err = &Store{path: *vaultPath, passphrase: passphrase}, nil
+		}
+		if err != nil {
+			fmt.Println("Error loading vault:", err)
+			return exitFailure
+		}
+	} else {
+		if *urisPath == "" {
+			*urisPath = filepath.Join(*outDir, "uris.csv")
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if *force {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		out, err := os.OpenFile(*urisPath, flags, 0600)
+		if errors.Is(err, os.ErrExist) {
+			fmt.Printf("Error: %s already exists (use -force to overwrite it)\n", *urisPath)
+			return exitFailure
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			return exitFailure
+		}
+		defer out.Close()
+		uris = csv.NewWriter(out)
+		uris.Write([]string{"name", "uri"})
+	}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	summary := newBatchSummary()
+	seen := map[string]bool{}
+	var enrolled int
+	var skipped []string
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		if len(record) != 2 {
+			skipped = append(skipped, fmt.Sprintf("row %d: expected issuer,account, got %d fields", row, len(record)))
+			continue
+		}
+		issuer, account := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		// Skip a header line
+		if row == 1 && strings.EqualFold(issuer, "issuer") {
+			continue
+		}
+		if issuer == "" || account == "" {
+			skipped = append(skipped, fmt.Sprintf("row %d: issuer and account must both be set", row))
+			continue
+		}
+		name := accountName(issuer, account)
+		qrName := qrFileName(name)
+		if seen[strings.ToLower(qrName)] {
+			skipped = append(skipped, fmt.Sprintf("row %d: %s is listed twice", row, name))
+			continue
+		}
+		seen[strings.ToLower(qrName)] = true
+		if store != nil {
+			if _, ok := store.Find(name); ok {
+				skipped = append(skipped, fmt.Sprintf("row %d: %s is already in %s", row, name, store.path))
+				continue
+			}
+		}
+
+		key, err := newKey(issuer, account, *secretSize, nil)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		img, err := qrImage(key, 200, *logo)
+		if err != nil {
+			fmt.Println("Error generating QR code:", err)
+			return exitFailure
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			fmt.Println("Error encoding QR code:", err)
+			return exitFailure
+		}
+		qrPath := filepath.Join(*outDir, qrName)
+		if err := writeQR(qrPath, buf.Bytes(), *force); err != nil {
+			skipped = append(skipped, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+
+		if store != nil {
+			store.Put(Account{Name: name, Issuer: issuer, Account: account, Secret: key.Secret()})
+		} else {
+			uris.Write([]string{name, key.URL()})
+		}
+		enrolled++
+		summary.succeed()
+		infof("row %d: %s -> %s\n", row, name, qrPath)
+	}
+
+	if store != nil && enrolled > 0 {
+		if err := store.Save(); err != nil {
+			fmt.Println("Error saving vault:", err)
+			return exitFailure
+		}
+	}
+	if uris != nil {
+		uris.Flush()
+		if err := uris.Error(); err != nil {
+			fmt.Println("Error writing URIs:", err)
+			return exitFailure
+		}
+	}
+
+	for _, s := range skipped {
+		summary.skip(s)
+		if !*jsonOut {
+			fmt.Println("Skipped", s)
+		}
+	}
+	infof("%d enrolled, %d skipped\n", enrolled, len(skipped))
+	if uris != nil && enrolled > 0 {
+		infof("%s holds the secrets in the clear, delete it once they are provisioned\n", *urisPath)
+	}
+	if *summaryFlag || *jsonOut {
+		summary.print(*jsonOut)
+	}
+	if len(skipped) > 0 {
+		return exitUsage
+	}
+	return exitOK
+}
+
+// qrFileName turns an account name into a safe file name for its QR code:
+// anything but letters, digits and .-_@ becomes _, so names with slashes or
+// colons can't point outside the output directory.
+func qrFileName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, name)
+	// No hidden files, and never "." or ".."
+	return strings.TrimLeft(safe, ".") + ".png"
+}
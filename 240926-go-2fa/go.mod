@@ -3,6 +3,14 @@ module github.com/go-project/240926-go-2fa
 go 1.22.0
 
 require (
-	github.com/boombuler/barcode v1.0.2 // indirect
-	github.com/pquerna/otp v1.4.0 // indirect
+	github.com/boombuler/barcode v1.0.2
+	github.com/pquerna/otp v1.4.0
+	github.com/shafiqsaaidin/go-project/term v0.0.0
+	github.com/shafiqsaaidin/go-project/version v0.0.0
+	golang.org/x/crypto v0.33.0
+)
+
+replace (
+	github.com/shafiqsaaidin/go-project/term => ../term
+	github.com/shafiqsaaidin/go-project/version => ../version
 )
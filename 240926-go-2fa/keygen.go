@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// Secret sizes in bytes. RFC 4226 requires at least 128 bits and recommends
+// 160, which is also the library default.
+const (
+	minSecretSize     = 16
+	maxSecretSize     = 64
+	defaultSecretSize = 20
+)
+
+// newKey generates a TOTP key with a secretSize byte secret read from random.
+// A nil random uses crypto/rand; tests can pass a fixed reader instead.
+func newKey(issuer, account string, secretSize uint, random io.Reader) (*otp.Key, error) {
+	if secretSize < minSecretSize || secretSize > maxSecretSize {
+		return nil, fmt.Errorf("secret size must be between %d and %d bytes, got %d", minSecretSize, maxSecretSize, secretSize)
+	}
+	if random == nil {
+		random = rand.Reader
+	}
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		SecretSize:  secretSize,
+		Rand:        random,
+	})
+}
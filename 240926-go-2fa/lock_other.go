@@ -0,0 +1,28 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockStore creates path.lock exclusively, waiting up to 10 seconds for
+// another process to remove it. Without flock a crashed process leaves the
+// lock file behind, and it has to be removed by hand.
+func lockStore(path string) (unlock func(), err error) {
+	name := path + ".lock"
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) || time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked (remove it if no other process is running): %w", name, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// lockout locks an account after limit failed validations within window,
+// for window, and forgets the failures after a success. The failures and
+// lock times are kept in a file so the lock holds across runs of the tool;
+// without that, retrying in a fresh process would dodge it.
+type lockout struct {
+	limit   int
+	window  time.Duration
+	path    string
+	entries map[string]*lockoutEntry
+}
+
+type lockoutEntry struct {
+	Failures    []time.Time `json:"failures,omitempty"`
+	LockedUntil *time.Time  `json:"locked_until,omitempty"`
+}
+
+// loadLockout reads the lockout state at path; a missing file is an empty
+// state. The limit is given as for -rate-limit, e.g. 5/15m.
+func loadLockout(spec, path string) (*lockout, error) {
+	limit, window, err := parseRateLimit(spec)
+	if err != nil {
+		return nil, err
+	}
+	l := &lockout{limit: limit, window: window, path: path, entries: map[string]*lockoutEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &l.entries); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// accountKey identifies an account in the lockout and rate limit state: by
+// name for a stored account, otherwise by a hash of its secret.
+func accountKey(a Account) string {
+	if a.Name != "" {
+		return "account:" + strings.ToLower(a.Name)
+	}
+	sum := sha256.Sum256([]byte(a.Secret))
+	return "secret:" + hex.EncodeToString(sum[:8])
+}
+
+// Locked reports whether key is locked at now, and until when.
+func (l *lockout) Locked(key string, now time.Time) (time.Time, bool) {
+	e := l.entries[key]
+	if l.limit == 0 || e == nil || e.LockedUntil == nil || !now.Before(*e.LockedUntil) {
+		return time.Time{}, false
+	}
+	return *e.LockedUntil, true
+}
+
+// Fail records a failed validation at now and reports whether it locked key.
+func (l *lockout) Fail(key string, now time.Time) (bool, error) {
+	if l.limit == 0 {
+		return false, nil
+	}
+	e := l.entries[key]
+	if e == nil {
+		e = &lockoutEntry{}
+		l.entries[key] = e
+	}
+	var recent []time.Time
+	for _, t := range e.Failures {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	e.Failures = append(recent, now)
+	locked := len(e.Failures) >= l.limit
+	if locked {
+		until := now.Add(l.window)
+		e.Failures, e.LockedUntil = nil, &until
+	}
+	return locked, l.save()
+}
+
+// Succeed clears the failures of key.
+func (l *lockout) Succeed(key string) error {
+	if _, ok := l.entries[key]; !ok {
+		return nil
+	}
+	delete(l.entries, key)
+	return l.save()
+}
+
+func (l *lockout) save() error {
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/pquerna/otp"
+)
+
+// maxLogoFraction is the largest logo, as a fraction of the QR code's width
+// and height, that still leaves the code readable. At the highest error
+// correction level a QR code survives about 30% damage, and a logo of a
+// quarter of each side covers roughly 6% of it.
+const maxLogoFraction = 4
+
+// qrImage renders the key as a size x size QR code. With a logo the code is
+// encoded with the highest error correction level and the logo is drawn
+// over its center.
+func qrImage(key *otp.Key, size int, logoPath string) (image.Image, error) {
+	if logoPath == "" {
+		return key.Image(size, size)
+	}
+
+	logo, err := loadLogo(logoPath)
+	if err != nil {
+		return nil, err
+	}
+	bounds := logo.Bounds()
+	if bounds.Dx() > size/maxLogoFraction || bounds.Dy() > size/maxLogoFraction {
+		return nil, fmt.Errorf("logo is %dx%d, at most %dx%d fits in a %dx%d QR code",
+			bounds.Dx(), bounds.Dy(), size/maxLogoFraction, size/maxLogoFraction, size, size)
+	}
+
+	code, err := qr.Encode(key.String(), qr.H, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	code, err = barcode.Scale(code, size, size)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(code.Bounds())
+	draw.Draw(img, img.Bounds(), code, code.Bounds().Min, draw.Src)
+	offset := image.Pt((size-bounds.Dx())/2, (size-bounds.Dy())/2)
+	draw.Draw(img, bounds.Sub(bounds.Min).Add(offset), logo, bounds.Min, draw.Over)
+	return img, nil
+}
+
+func loadLogo(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	logo, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading logo %s: %w", path, err)
+	}
+	return logo, nil
+}
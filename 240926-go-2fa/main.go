@@ -3,61 +3,226 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"image/png"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/pquerna/otp"
-	"github.com/pquerna/otp/totp"
+	"github.com/shafiqsaaidin/go-project/term"
+	"github.com/shafiqsaaidin/go-project/version"
 )
 
-func display(key *otp.Key, data []byte) {
-	fmt.Printf("Issuer: %s\n", key.Issuer())
-	fmt.Printf("Account Name: %s\n", key.AccountName())
-	fmt.Printf("Secret: %s\n", key.Secret())
-	fmt.Println("Writing PNG to qr-code.png....")
-	os.WriteFile("qr-code.png", data, 0644)
-	fmt.Println("")
-	fmt.Println("Please add your TOTP to your OTP Application now!")
-	fmt.Println("")
+func display(key *otp.Key, data []byte, encoder, qrPath string, force bool) error {
+	infof("Issuer: %s\n", key.Issuer())
+	infof("Account Name: %s\n", key.AccountName())
+	infof("Secret: %s\n", key.Secret())
+	if encoder == "steam" {
+		infof("URI: %s\n", steamURL(key))
+	}
+	infof("Writing PNG to %s....\n", qrPath)
+	if err := writeQR(qrPath, data, force); err != nil {
+		return err
+	}
+	infoln("")
+	infof("%s", manualEntry(key))
+	infoln("")
+	infoln("Please add your TOTP to your OTP Application now!")
+	infoln("")
+	return nil
 }
 
-func prompForPasscode() string {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter Passcode: ")
-	text, _ := reader.ReadString('\n')
-	return text
+// writeQR saves the QR code PNG to path. The QR code contains the secret, so
+// the file is only readable by its owner, and an existing file is kept
+// unless force is set.
+func writeQR(path string, data []byte, force bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating directory for %s: %w", path, err)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists (use -force to overwrite it)", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// normalizePasscode drops the surrounding whitespace of a passcode, including
+// the \n or \r\n that echo and Windows shells leave on piped input.
+func normalizePasscode(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// stdin is shared by every prompt, so piped input isn't lost to buffering
+var stdin = bufio.NewReader(os.Stdin)
+
+func prompForPasscode(prompt string) string {
+	// Only show the prompt when someone is typing, so piped input stays clean
+	if term.IsTerminal(os.Stdin) {
+		fmt.Print(prompt)
+	}
+	text, _ := stdin.ReadString('\n')
+	return normalizePasscode(text)
 }
 
 func main() {
-	key, err := totp.Generate(totp.GenerateOpts{
-		Issuer:      "Example.com",
-		AccountName: "user@example.com",
-	})
+	if err := initClock(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(exitUsage)
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate-batch":
+			os.Exit(runValidateBatch(os.Args[2:]))
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "import-migration":
+			os.Exit(runImportMigration(os.Args[2:]))
+		case "decode-uri":
+			os.Exit(runDecodeURI(os.Args[2:]))
+		case "backup-codes":
+			os.Exit(runBackupCodes(os.Args[2:]))
+		case "vault":
+			os.Exit(runVault(os.Args[2:]))
+		case "rotate":
+			os.Exit(runRotate(os.Args[2:]))
+		case "enroll-batch":
+			os.Exit(runEnrollBatch(os.Args[2:]))
+		case "watch-all":
+			os.Exit(runWatchAll(os.Args[2:]))
+		case "version":
+			version.Print(os.Stdout)
+			return
+		}
+	}
+
+	passcodeFlag := flag.String("passcode", "", "Passcode to validate (skips the interactive prompt)")
+	rateLimit := flag.String("rate-limit", "5/30s", "Maximum validation attempts per account, as attempts/window (0 to disable)")
+	rateState := flag.String("rate-state", "", "File to keep rate limit state in across runs")
+	secretSize := flag.Uint("secret-size", defaultSecretSize, fmt.Sprintf("Secret size in bytes (%d-%d)", minSecretSize, maxSecretSize))
+	qrOut := flag.String("qr-out", "qr-code.png", "Where to write the QR code PNG")
+	force := flag.Bool("force", false, "Overwrite the QR code file if it exists")
+	diagnose := flag.Bool("diagnose", false, fmt.Sprintf("On an invalid code, check up to %d periods either side to tell a wrong code from a wrong clock", diagnoseSteps))
+	logo := flag.String("logo", "", "PNG logo to draw in the center of the QR code")
+	enrollCodes := flag.Int("enroll-codes", 1, "Codes needed to finish enrollment: 1, or 2 from consecutive periods to confirm the app's clock")
+	encoder := flag.String("encoder", "", "Code encoder: empty for standard digits, or steam for Steam Guard codes")
+	flag.BoolVar(&quiet, "quiet", false, quietUsage)
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	flag.Parse()
+
+	if *showVersion {
+		version.Print(os.Stdout)
+		return
+	}
+
+	if *enrollCodes != 1 && *enrollCodes != 2 {
+		fmt.Println("Error: -enroll-codes must be 1 or 2")
+		os.Exit(exitUsage)
+	}
+	if *encoder != "" && *encoder != "steam" {
+		fmt.Println("Error: unknown encoder", *encoder)
+		os.Exit(exitUsage)
+	}
+
+	limiter, err := newRateLimiter(*rateLimit, *rateState)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(exitUsage)
+	}
+
+	key, err := newKey("Example.com", "user@example.com", *secretSize, nil)
 	if err != nil {
-		panic(err)
+		fmt.Println("Error:", err)
+		os.Exit(exitUsage)
+	}
+	infof("Generated a %d-bit secret\n", *secretSize*8)
+
+	// Steam authenticator apps need the encoder in the QR code as well
+	if *encoder == "steam" {
+		key, err = otp.NewKeyFromURL(steamURL(key))
+		if err != nil {
+			fmt.Println("Error building Steam key:", err)
+			os.Exit(exitFailure)
+		}
 	}
 
 	// Conver TOTP key into a PNG
 	var buf bytes.Buffer
-	img, err := key.Image(200, 200)
+	img, err := qrImage(key, 200, *logo)
 	if err != nil {
-		panic(err)
+		fmt.Println("Error generating QR code:", err)
+		os.Exit(exitFailure)
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		fmt.Println("Error encoding QR code:", err)
+		os.Exit(exitFailure)
 	}
-	png.Encode(&buf, img)
 
 	// Display the QR code to the user
-	display(key, buf.Bytes())
+	if err := display(key, buf.Bytes(), *encoder, *qrOut, *force); err != nil {
+		fmt.Println("Error writing QR code:", err)
+		os.Exit(exitFailure)
+	}
 
 	// Now validate the user's successfully added the passcode.
-	fmt.Println("Validaing TOTP...")
-	passcode := prompForPasscode()
-	valid := totp.Validate(passcode, key.Secret())
-	if valid {
-		println("Valid passcode")
-		os.Exit(0)
-	} else {
+	infoln("Validaing TOTP...")
+	passcode := normalizePasscode(*passcodeFlag)
+	if passcode == "" {
+		passcode = prompForPasscode("Enter Passcode: ")
+	}
+	enteredAt := clockNow()
+	// The secret is new on every run, so limit by the account being enrolled
+	limitKey := accountKey(Account{Name: key.Issuer() + ":" + key.AccountName()})
+	allowed, err := limiter.Allow(limitKey)
+	if err != nil {
+		fmt.Println("Error saving rate limit state:", err)
+	}
+	result := ValidationResult{Reason: ReasonRateLimited}
+	if allowed {
+		searchSteps := 0
+		if *diagnose {
+			searchSteps = diagnoseSteps
+		}
+		result = validateCode(passcode, []string{key.Secret()}, *encoder, enteredAt, Account{}.validateOpts(), searchSteps)
+	}
+	switch result.Reason {
+	case ReasonValid, ReasonClockDrift:
+		if !quiet {
+			println("Valid passcode")
+		}
+		// Report drift so users can be told to fix their clock
+		if result.Reason == ReasonClockDrift && !quiet {
+			println("Clock drift:", describeDrift(result.SkewOffset))
+		}
+		if *enrollCodes == 2 {
+			if ok, why := confirmNextCode(passcode, key.Secret(), *encoder, enteredAt, limiter, limitKey); !ok {
+				println("Enrollment failed:", why)
+				os.Exit(exitInvalid)
+			}
+			if !quiet {
+				println("Enrollment confirmed with two consecutive codes")
+			}
+		}
+	case ReasonRateLimited:
+		println("Rate limited, too many attempts. Try again later.")
+	default:
 		println("Invalid passcode!")
-		os.Exit(1)
+		if *diagnose {
+			println("Diagnosis:", describeDiagnosis(result.SkewOffset, result.Reason == ReasonOutsideWindow))
+		}
 	}
+	os.Exit(result.exitCode())
 }
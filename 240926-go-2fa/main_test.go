@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteQR(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.png")
+	if err := os.WriteFile(existing, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A regular file where a directory should be can't be written to, even
+	// by root
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		force   bool
+		wantErr string
+	}{
+		{"new file", filepath.Join(dir, "qr.png"), false, ""},
+		{"missing directories", filepath.Join(dir, "a", "b", "qr.png"), false, ""},
+		{"existing without force", existing, false, "already exists"},
+		{"existing with force", existing, true, ""},
+		{"unwritable directory", filepath.Join(blocker, "qr.png"), false, "creating directory"},
+		{"path is a directory", dir, true, "is a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writeQR(tt.path, []byte("png"), tt.force)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("writeQR(%q) error = %v, want one containing %q", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeQR(%q): %v", tt.path, err)
+			}
+			data, err := os.ReadFile(tt.path)
+			if err != nil || string(data) != "png" {
+				t.Fatalf("read back %q, %v", data, err)
+			}
+			// The QR code holds the secret
+			if info, _ := os.Stat(tt.path); info.Mode().Perm() != 0600 {
+				t.Errorf("mode %v, want 0600", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestDisplayReportsWriteFailure(t *testing.T) {
+	quiet = true
+	defer func() { quiet = false }()
+	key, err := newKey("Example.com", "user@example.com", defaultSecretSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := display(key, []byte("png"), "", filepath.Join(blocker, "qr.png"), false); err == nil {
+		t.Error("display succeeded although the QR code couldn't be written")
+	}
+}
+
+func TestNormalizePasscode(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "123456", "123456"},
+		{"unix newline", "123456\n", "123456"},
+		{"windows newline", "123456\r\n", "123456"},
+		{"carriage return", "123456\r", "123456"},
+		{"spaces", "  123456  ", "123456"},
+		{"tabs and newline", "\t123456 \r\n", "123456"},
+		{"empty", "\r\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizePasscode(tt.in); got != tt.want {
+				t.Errorf("normalizePasscode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptPasscodeFromPipe(t *testing.T) {
+	saved := stdin
+	defer func() { stdin = saved }()
+
+	// Two passcodes piped in one go, as for -enroll-codes 2
+	stdin = bufio.NewReader(strings.NewReader("123456\r\n 654321 \n"))
+	for _, want := range []string{"123456", "654321", ""} {
+		if got := prompForPasscode("Enter Passcode: "); got != want {
+			t.Errorf("prompForPasscode() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pquerna/otp"
+)
+
+// manualEntry formats the fields authenticator apps ask for when a QR code
+// can't be scanned, with the secret in groups of four to make it easier to
+// type.
+func manualEntry(key *otp.Key) string {
+	keyType := "Time-based"
+	if key.Type() == "hotp" {
+		keyType = "Counter-based"
+	}
+	var b strings.Builder
+	fmt.Fprintln(&b, "Can't scan the QR code? Enter these in your app instead:")
+	fmt.Fprintln(&b, "  Account:  ", key.AccountName())
+	fmt.Fprintln(&b, "  Issuer:   ", key.Issuer())
+	fmt.Fprintln(&b, "  Key:      ", groupSecret(key.Secret()))
+	fmt.Fprintln(&b, "  Type:     ", keyType)
+	fmt.Fprintln(&b, "  Algorithm:", key.Algorithm())
+	fmt.Fprintln(&b, "  Digits:   ", key.Digits())
+	if key.Type() != "hotp" {
+		fmt.Fprintln(&b, "  Period:   ", key.Period(), "seconds")
+	}
+	return b.String()
+}
+
+// groupSecret splits a base32 secret into space separated groups of four,
+// dropping any padding, e.g. "JBSW Y3DP EHPK 3PXP".
+func groupSecret(secret string) string {
+	secret = strings.TrimRight(secret, "=")
+	var groups []string
+	for len(secret) > 4 {
+		groups = append(groups, secret[:4])
+		secret = secret[4:]
+	}
+	return strings.Join(append(groups, secret), " ")
+}
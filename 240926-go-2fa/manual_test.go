@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pquerna/otp"
+)
+
+func TestGroupSecret(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"JBSWY3DPEHPK3PXP", "JBSW Y3DP EHPK 3PXP"},
+		{"JBSWY3DPEHPK3PXPJBSWY3D=", "JBSW Y3DP EHPK 3PXP JBSW Y3D"},
+		{"JBSWY3DPE", "JBSW Y3DP E"},
+		{"JBSW", "JBSW"},
+		{"JB", "JB"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := groupSecret(tt.in); got != tt.want {
+			t.Errorf("groupSecret(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestManualEntry(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want []string
+		skip string
+	}{
+		{
+			"otpauth://totp/Example.com:alice?secret=JBSWY3DPEHPK3PXP&issuer=Example.com&period=60",
+			[]string{"alice", "Example.com", "JBSW Y3DP EHPK 3PXP", "Time-based", "Period:    60 seconds"},
+			"",
+		},
+		{
+			"otpauth://hotp/Example.com:bob?secret=JBSWY3DPEHPK3PXP&issuer=Example.com&counter=0",
+			[]string{"bob", "Counter-based"},
+			"Period",
+		},
+	}
+	for _, tt := range tests {
+		key, err := otp.NewKeyFromURL(tt.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := manualEntry(key)
+		for _, w := range tt.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("manualEntry(%s) lacks %q:\n%s", tt.uri, w, got)
+			}
+		}
+		if tt.skip != "" && strings.Contains(got, tt.skip) {
+			t.Errorf("manualEntry(%s) shows %q:\n%s", tt.uri, tt.skip, got)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Google Authenticator exports accounts as otpauth-migration://offline?data=
+// with a base64 protobuf MigrationPayload. The message is small enough that
+// it is decoded by hand here:
+//
+//	MigrationPayload { repeated OtpParameters otp_parameters = 1; ... }
+//	OtpParameters {
+//	  bytes secret = 1; string name = 2; string issuer = 3;
+//	  Algorithm algorithm = 4; DigitCount digits = 5; OtpType type = 6;
+//	  int64 counter = 7;
+//	}
+
+var migrationAlgorithms = map[uint64]string{1: "SHA1", 2: "SHA256", 3: "SHA512", 4: "MD5"}
+var migrationDigits = map[uint64]int{1: 6, 2: 8}
+
+const migrationTypeHOTP = 1
+
+// runImportMigration imports the accounts of one or more migration URIs into
+// the store and returns the exit code.
+func runImportMigration(args []string) int {
+	fs := flag.NewFlagSet("import-migration", flag.ExitOnError)
+	storePath := fs.String("store", "accounts.json", "Accounts file to import into")
+	fs.BoolVar(&quiet, "quiet", false, quietUsage)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fmt.Println("usage: import-migration [-store file] 'otpauth-migration://offline?data=...' ...")
+		return exitUsage
+	}
+	// Hold the lock from load to save, so a concurrent update of the store
+	// isn't lost
+	unlock, err := lockStore(*storePath)
+	if err != nil {
+		fmt.Println("Error locking store:", err)
+		return exitFailure
+	}
+	defer unlock()
+	store, err := LoadStore(*storePath)
+	if err != nil {
+		fmt.Println("Error loading store:", err)
+		return exitFailure
+	}
+
+	imported := 0
+	for _, uri := range fs.Args() {
+		accounts, skipped, err := parseMigrationURI(uri)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return exitFailure
+		}
+		for _, name := range skipped {
+			infoln("Skipped HOTP account", name)
+		}
+		for _, a := range accounts {
+			store.Put(a)
+			infoln("Imported", a.Name)
+			imported++
+		}
+	}
+	if err := store.Save(); err != nil {
+		fmt.Println("Error saving store:", err)
+		return exitFailure
+	}
+	infof("Imported %d accounts into %s\n", imported, *storePath)
+	return exitOK
+}
+
+// parseMigrationURI returns the TOTP accounts in a migration URI, and the
+// names of the HOTP accounts it skipped.
+func parseMigrationURI(uri string) ([]Account, []string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "otpauth-migration" {
+		return nil, nil, fmt.Errorf("not an otpauth-migration URI")
+	}
+	data := u.Query().Get("data")
+	if data == "" {
+		return nil, nil, fmt.Errorf("migration URI has no data parameter")
+	}
+	// A + that wasn't percent-encoded comes out of the query as a space
+	data = strings.ReplaceAll(data, " ", "+")
+	payload, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		payload, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding data: %w", err)
+	}
+
+	var accounts []Account
+	var skipped []string
+	err = protoFields(payload, func(field uint64, value uint64, bytes []byte) error {
+		if field != 1 || bytes == nil {
+			return nil
+		}
+		a, otpType, err := parseOtpParameters(bytes)
+		if err != nil {
+			return err
+		}
+		if otpType == migrationTypeHOTP {
+			skipped = append(skipped, a.Name)
+			return nil
+		}
+		accounts = append(accounts, a)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding data: %w", err)
+	}
+	return accounts, skipped, nil
+}
+
+func parseOtpParameters(msg []byte) (Account, uint64, error) {
+	a := Account{Algorithm: "SHA1", Digits: 6, Period: period}
+	var otpType uint64
+	var name string
+	err := protoFields(msg, func(field uint64, value uint64, bytes []byte) error {
+		switch field {
+		case 1:
+			a.Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(bytes)
+		case 2:
+			name = string(bytes)
+		case 3:
+			a.Issuer = string(bytes)
+		case 4:
+			if alg, ok := migrationAlgorithms[value]; ok {
+				a.Algorithm = alg
+			}
+		case 5:
+			if digits, ok := migrationDigits[value]; ok {
+				a.Digits = digits
+			}
+		case 6:
+			otpType = value
+		}
+		return nil
+	})
+	if err != nil {
+		return Account{}, 0, err
+	}
+
+	// The name is often "issuer:account"
+	a.Account = name
+	if issuer, account, ok := strings.Cut(name, ":"); ok {
+		a.Account = strings.TrimSpace(account)
+		if a.Issuer == "" {
+			a.Issuer = issuer
+		}
+	}
+	a.Name = accountName(a.Issuer, a.Account)
+	return a, otpType, nil
+}
+
+// protoFields calls fn for each field of a protobuf message: value is set for
+// varints, bytes for length-delimited fields. Other wire types are skipped.
+func protoFields(msg []byte, fn func(field uint64, value uint64, bytes []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := protoVarint(msg)
+		if n == 0 {
+			return errors.New("truncated message")
+		}
+		msg = msg[n:]
+		field, wireType := tag>>3, tag&7
+
+		switch wireType {
+		case 0:
+			value, n := protoVarint(msg)
+			if n == 0 {
+				return errors.New("truncated varint")
+			}
+			msg = msg[n:]
+			if err := fn(field, value, nil); err != nil {
+				return err
+			}
+		case 2:
+			length, n := protoVarint(msg)
+			if n == 0 || uint64(len(msg)-n) < length {
+				return errors.New("truncated field")
+			}
+			bytes := msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+			if err := fn(field, 0, bytes); err != nil {
+				return err
+			}
+		case 1:
+			if len(msg) < 8 {
+				return errors.New("truncated field")
+			}
+			msg = msg[8:]
+		case 5:
+			if len(msg) < 4 {
+				return errors.New("truncated field")
+			}
+			msg = msg[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+	}
+	return nil
+}
+
+// protoVarint decodes a varint and returns it with the number of bytes read,
+// or 0 bytes if msg ends too early.
+func protoVarint(msg []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(msg) && i < 10; i++ {
+		value |= uint64(msg[i]&0x7f) << (7 * i)
+		if msg[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+// Exit codes, the same for every command
+const (
+	exitOK      = 0
+	exitFailure = 1 // something went wrong, e.g. a file couldn't be written
+	exitUsage   = 2 // bad flags or input
+	exitInvalid = 3 // the passcode didn't verify
+)
+
+// quiet is set by -quiet: only errors and requested output are printed.
+var quiet bool
+
+const quietUsage = "Only print errors; the exit code tells the result"
+
+// infof prints an informational message unless -quiet is set.
+func infof(format string, a ...any) {
+	if !quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+// infoln is infof with fmt.Println formatting.
+func infoln(a ...any) {
+	if !quiet {
+		fmt.Println(a...)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimiter allows at most limit validation attempts per account within
+// a sliding window. When path is set the attempts are kept in that file, so
+// the limit also holds across separate runs of the tool.
+type rateLimiter struct {
+	limit    int
+	window   time.Duration
+	path     string
+	attempts map[string][]time.Time
+}
+
+// parseRateLimit parses "5/30s" into 5 attempts per 30 seconds. "0" turns
+// the limiter off.
+func parseRateLimit(s string) (int, time.Duration, error) {
+	if s == "0" || s == "" {
+		return 0, 0, nil
+	}
+	count, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate limit %q must look like 5/30s", s)
+	}
+	limit, err := strconv.Atoi(count)
+	if err != nil || limit < 1 {
+		return 0, 0, fmt.Errorf("rate limit %q: bad attempt count", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("rate limit %q: bad window", s)
+	}
+	return limit, d, nil
+}
+
+// newRateLimiter returns a limiter for spec, e.g. 5/30s, keeping its state
+// at path when that is set.
+func newRateLimiter(spec, path string) (*rateLimiter, error) {
+	limit, window, err := parseRateLimit(spec)
+	if err != nil {
+		return nil, err
+	}
+	l := &rateLimiter{limit: limit, window: window, path: path}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *rateLimiter) load() error {
+	l.attempts = map[string][]time.Time{}
+	if l.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &l.attempts); err != nil {
+		return fmt.Errorf("reading %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// Allow records an attempt for key, see accountKey, and reports whether it
+// is within the limit. With a state file the file is locked and read again
+// first, so parallel runs share the limit.
+func (l *rateLimiter) Allow(key string) (bool, error) {
+	if l.limit == 0 {
+		return true, nil
+	}
+	if l.path != "" {
+		unlock, err := lockStore(l.path)
+		if err != nil {
+			return false, err
+		}
+		defer unlock()
+		if err := l.load(); err != nil {
+			return false, err
+		}
+	}
+
+	// Forget attempts that left the window, so the state doesn't grow
+	now := time.Now()
+	for k, times := range l.attempts {
+		var recent []time.Time
+		for _, t := range times {
+			if now.Sub(t) < l.window {
+				recent = append(recent, t)
+			}
+		}
+		if len(recent) == 0 {
+			delete(l.attempts, k)
+		} else {
+			l.attempts[k] = recent
+		}
+	}
+	allowed := len(l.attempts[key]) < l.limit
+	if allowed {
+		l.attempts[key] = append(l.attempts[key], now)
+	}
+	return allowed, l.save()
+}
+
+func (l *rateLimiter) save() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(l.attempts)
+	if err != nil {
+		return err
+	}
+	// Write to a temp file first so a crash never leaves a half written state
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in         string
+		wantLimit  int
+		wantWindow time.Duration
+		wantErr    bool
+	}{
+		{"5/30s", 5, 30 * time.Second, false},
+		{"10/15m", 10, 15 * time.Minute, false},
+		{"0", 0, 0, false},
+		{"", 0, 0, false},
+		{"5", 0, 0, true},
+		{"x/30s", 0, 0, true},
+		{"0/30s", 0, 0, true},
+		{"-1/30s", 0, 0, true},
+		{"5/soon", 0, 0, true},
+		{"5/0s", 0, 0, true},
+	}
+	for _, tt := range tests {
+		limit, window, err := parseRateLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRateLimit(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if limit != tt.wantLimit || window != tt.wantWindow {
+			t.Errorf("parseRateLimit(%q) = %d, %s, want %d, %s", tt.in, limit, window, tt.wantLimit, tt.wantWindow)
+		}
+	}
+}
+
+func TestRateLimiterPerAccount(t *testing.T) {
+	l, err := newRateLimiter("2/1m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := accountKey(Account{Name: "alice"}), accountKey(Account{Name: "bob"})
+	for i, want := range []bool{true, true, false, false} {
+		if got, _ := l.Allow(alice); got != want {
+			t.Errorf("attempt %d for alice: allowed = %v, want %v", i+1, got, want)
+		}
+	}
+	if got, _ := l.Allow(bob); !got {
+		t.Error("bob was limited by alice's attempts")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	l, err := newRateLimiter("0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("secret:x"); !ok {
+			t.Fatalf("attempt %d limited with the limiter off", i+1)
+		}
+	}
+}
+
+func TestRateLimiterState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rate.json")
+	key := accountKey(Account{Name: "alice"})
+	for run := 1; run <= 3; run++ {
+		// A fresh limiter per run, like separate invocations of the tool
+		l, err := newRateLimiter("2/1m", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowed, err := l.Allow(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := run <= 2; allowed != want {
+			t.Errorf("run %d: allowed = %v, want %v", run, allowed, want)
+		}
+	}
+
+	// Attempts that left the window are dropped from the file
+	l, err := newRateLimiter("2/1m", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.attempts["account:old"] = []time.Time{time.Now().Add(-time.Hour)}
+	if err := l.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Allow(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.attempts["account:old"]; ok {
+		t.Error("expired attempts were kept in the state file")
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	if accountKey(Account{Name: "Alice"}) != accountKey(Account{Name: "alice", Secret: "JBSWY3DPEHPK3PXP"}) {
+		t.Error("a stored account must be keyed by its name alone, ignoring case")
+	}
+	if accountKey(Account{Secret: "JBSWY3DPEHPK3PXP"}) == accountKey(Account{Secret: "KRSXG5CTMVRXEZLU"}) {
+		t.Error("different secrets share a key")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image/png"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// runRotate gives an account in the store a new secret and QR code, keeping
+// the old secret valid for an overlap window, and returns the exit code.
+func runRotate(args []string) int {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	storePath := fs.String("store", "accounts.json", "Accounts file")
+	overlap := fs.Duration("overlap", 24*time.Hour, "How long the old secret keeps working")
+	secretSize := fs.Uint("secret-size", defaultSecretSize, fmt.Sprintf("Secret size in bytes (%d-%d)", minSecretSize, maxSecretSize))
+	qrOut := fs.String("qr-out", "qr-code.png", "Where to write the new QR code PNG")
+	force := fs.Bool("force", false, "Overwrite the QR code file if it exists")
+	fs.BoolVar(&quiet, "quiet", false, quietUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rotate [flags] NAME")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *secretSize < minSecretSize || *secretSize > maxSecretSize {
+		fmt.Printf("Error: secret size must be between %d and %d bytes, got %d\n", minSecretSize, maxSecretSize, *secretSize)
+		return exitUsage
+	}
+	// Hold the lock from load to save, so a concurrent update of another
+	// account isn't lost
+	unlock, err := lockStore(*storePath)
+	if err != nil {
+		fmt.Println("Error locking store:", err)
+		return exitFailure
+	}
+	defer unlock()
+	store, err := LoadStore(*storePath)
+	if err != nil {
+		fmt.Println("Error loading store:", err)
+		return exitFailure
+	}
+	account, ok := store.Find(fs.Arg(0))
+	if !ok {
+		fmt.Printf("Error: no account %q in %s\n", fs.Arg(0), *storePath)
+		return exitFailure
+	}
+
+	opts := account.validateOpts()
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      account.Issuer,
+		AccountName: account.Account,
+		Period:      opts.Period,
+		Digits:      opts.Digits,
+		Algorithm:   opts.Algorithm,
+		SecretSize:  *secretSize,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return exitFailure
+	}
+	if err := writeRotatedQR(key, *qrOut, *force); err != nil {
+		fmt.Println("Error writing QR code:", err)
+		return exitFailure
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	validUntil := now.Add(*overlap)
+	account.PreviousSecret = account.Secret
+	account.PreviousValidUntil = &validUntil
+	account.RotatedAt = &now
+	account.Secret = key.Secret()
+	if err := store.Save(); err != nil {
+		fmt.Println("Error saving store:", err)
+		return exitFailure
+	}
+	infof("Rotated %s, the old secret works until %s\n", account.Name, validUntil.Format(time.RFC3339))
+	return exitOK
+}
+
+func writeRotatedQR(key *otp.Key, qrPath string, force bool) error {
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return display(key, buf.Bytes(), "", qrPath, force)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// minSecretChars is the shortest secret accepted on input: 16 base32
+// characters, i.e. 80 bits.
+const minSecretChars = 16
+
+// normalizeSecret cleans up a base32 secret typed or pasted by a user. Spaces
+// and dashes are dropped and letters uppercased, then the secret is checked
+// for the base32 alphabet, well-formed padding and minimum length so a typo
+// gets a clear message instead of a library error later on.
+func normalizeSecret(s string) (string, error) {
+	s = strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '-' {
+			return -1
+		}
+		return r
+	}, s))
+	if s == "" {
+		return "", fmt.Errorf("secret is empty")
+	}
+
+	data := strings.TrimRight(s, "=")
+	for i, r := range data {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '2' && r <= '7':
+		case r == '=':
+			return "", fmt.Errorf("secret has padding '=' at position %d, it is only allowed at the end", i+1)
+		case r == '0' || r == '1' || r == '8' || r == '9':
+			return "", fmt.Errorf("secret has %q at position %d, base32 only uses the digits 2-7 (did you mean %q?)", r, i+1, lookalike(r))
+		default:
+			return "", fmt.Errorf("secret has %q at position %d, base32 only uses A-Z and 2-7", r, i+1)
+		}
+	}
+	if padding := len(s) - len(data); padding > 0 && len(s)%8 != 0 {
+		return "", fmt.Errorf("secret has %d padding characters, padded secrets must be a multiple of 8 characters long", padding)
+	}
+	if len(data) < minSecretChars {
+		return "", fmt.Errorf("secret is %d characters long, at least %d are needed", len(data), minSecretChars)
+	}
+	// Base32 packs 5 bytes into 8 characters, so a partial last group can
+	// only be 2, 4, 5 or 7 characters long
+	switch len(data) % 8 {
+	case 1, 3, 6:
+		return "", fmt.Errorf("secret is %d characters long, which isn't a valid base32 length (a character missing or extra?)", len(data))
+	}
+	return data, nil
+}
+
+// lookalike returns the base32 letter users usually mean when they type a
+// digit that isn't in the alphabet.
+func lookalike(r rune) rune {
+	switch r {
+	case '0':
+		return 'O'
+	case '1':
+		return 'I'
+	case '8':
+		return 'B'
+	}
+	return 'G'
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"plain", "JBSWY3DPEHPK3PXP", "JBSWY3DPEHPK3PXP", ""},
+		{"lowercase", "jbswy3dpehpk3pxp", "JBSWY3DPEHPK3PXP", ""},
+		{"spaced", "jbsw y3dp ehpk 3pxp", "JBSWY3DPEHPK3PXP", ""},
+		{"dashes and tabs", "JBSW-Y3DP\tEHPK-3PXP", "JBSWY3DPEHPK3PXP", ""},
+		{"padded", "JBSWY3DPEHPK3PXPJBSWY3D=", "JBSWY3DPEHPK3PXPJBSWY3D", ""},
+		{"padded lowercase", "jbswy3dpehpk3pxpjbswy3d=", "JBSWY3DPEHPK3PXPJBSWY3D", ""},
+		{"empty", "  ", "", "empty"},
+		{"digit one", "JBSWY3DPEHPK3PX1", "", `did you mean 'I'`},
+		{"digit zero", "0BSWY3DPEHPK3PXP", "", `did you mean 'O'`},
+		{"bad character", "JBSWY3DPEHPK3PX!", "", "only uses A-Z and 2-7"},
+		{"padding in the middle", "JBSWY3DP=HPK3PXP", "", "only allowed at the end"},
+		{"short padding", "JBSWY3DPEHPK3PXPJB=", "", "multiple of 8"},
+		{"too short", "JBSWY3DP", "", "at least 16"},
+		{"bad length", "JBSWY3DPEHPK3PXPJ", "", "valid base32 length"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeSecret(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("normalizeSecret(%q) error = %v, want one containing %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeSecret(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeSecret(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+)
+
+// Steam Guard codes are 5 characters from this alphabet instead of digits.
+const (
+	steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+	steamDigits   = 5
+	steamPeriod   = 30
+)
+
+// steamCode computes the Steam Guard code for secret at time t. It is the
+// usual HMAC-SHA1 TOTP with the truncated value spelled in steamAlphabet.
+func steamCode(secret string, t time.Time) (string, error) {
+	secret = strings.ToUpper(strings.TrimRight(secret, "="))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/steamPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	code := make([]byte, steamDigits)
+	for i := range code {
+		code[i] = steamAlphabet[value%uint32(len(steamAlphabet))]
+		value /= uint32(len(steamAlphabet))
+	}
+	return string(code), nil
+}
+
+// steamURL returns the key's otpauth URI with the parameters authenticator
+// apps use to recognise a Steam Guard account.
+func steamURL(key *otp.Key) string {
+	u, err := url.Parse(key.URL())
+	if err != nil {
+		return key.URL()
+	}
+	q := u.Query()
+	q.Set("digits", "5")
+	q.Set("encoder", "steam")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// Account is one TOTP account kept in the store.
+type Account struct {
+	Name      string `json:"name"`
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account"`
+	Secret    string `json:"secret"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Digits    int    `json:"digits,omitempty"`
+	Period    uint   `json:"period,omitempty"`
+
+	// After a rotation the old secret keeps working until
+	// PreviousValidUntil, so the user can re-enroll without being locked out
+	PreviousSecret     string     `json:"previous_secret,omitempty"`
+	PreviousValidUntil *time.Time `json:"previous_valid_until,omitempty"`
+	RotatedAt          *time.Time `json:"rotated_at,omitempty"`
+
+	BackupCodes []BackupCode `json:"backup_codes,omitempty"`
+}
+
+var accountAlgorithms = map[string]otp.Algorithm{
+	"SHA1":   otp.AlgorithmSHA1,
+	"SHA256": otp.AlgorithmSHA256,
+	"SHA512": otp.AlgorithmSHA512,
+	"MD5":    otp.AlgorithmMD5,
+}
+
+// validateOpts returns the code parameters of the account, with the usual
+// defaults for fields that aren't set.
+func (a Account) validateOpts() totp.ValidateOpts {
+	opts := totp.ValidateOpts{
+		Period:    period,
+		Skew:      1,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+	if a.Period != 0 {
+		opts.Period = a.Period
+	}
+	if a.Digits != 0 {
+		opts.Digits = otp.Digits(a.Digits)
+	}
+	if alg, ok := accountAlgorithms[strings.ToUpper(a.Algorithm)]; ok {
+		opts.Algorithm = alg
+	}
+	return opts
+}
+
+// secrets returns the secrets that are valid at t: the current one and, during
+// the overlap after a rotation, the previous one.
+func (a Account) secrets(t time.Time) []string {
+	secrets := []string{a.Secret}
+	if a.PreviousSecret != "" && a.PreviousValidUntil != nil && t.Before(*a.PreviousValidUntil) {
+		secrets = append(secrets, a.PreviousSecret)
+	}
+	return secrets
+}
+
+// accountName is the name an account is stored under, "issuer:account".
+func accountName(issuer, account string) string {
+	if issuer == "" {
+		return account
+	}
+	return issuer + ":" + account
+}
+
+// Store is a JSON file of accounts. It holds secrets in the clear, so it is
+// written with owner-only permissions, unless it was loaded from a vault.
+type Store struct {
+	path       string
+	passphrase string    // set for a vault: Save encrypts with it
+	Accounts   []Account `json:"accounts"`
+}
+
+// LoadStore reads the store at path. A missing file gives an empty store.
+func LoadStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Find returns the account with the given name.
+func (s *Store) Find(name string) (*Account, bool) {
+	for i := range s.Accounts {
+		if strings.EqualFold(s.Accounts[i].Name, name) {
+			return &s.Accounts[i], true
+		}
+	}
+	return nil, false
+}
+
+// Put adds a, replacing an account with the same name.
+func (s *Store) Put(a Account) {
+	if a.Name == "" {
+		a.Name = accountName(a.Issuer, a.Account)
+	}
+	if existing, ok := s.Find(a.Name); ok {
+		*existing = a
+		return
+	}
+	s.Accounts = append(s.Accounts, a)
+}
+
+// Save writes the store back to its file, through a temp file so a crash
+// never leaves it half written.
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if s.passphrase != "" {
+		if data, err = sealVault(data, s.passphrase); err != nil {
+			return err
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// maxSummaryReasons caps how many failure reasons a summary lists.
+const maxSummaryReasons = 20
+
+// batchSummary counts the outcome of a batch command for -summary and
+// -json, so CI can check one artifact after a bulk run.
+type batchSummary struct {
+	Processed int      `json:"processed"`
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Skipped   int      `json:"skipped"`
+	Elapsed   float64  `json:"elapsed_seconds"`
+	Reasons   []string `json:"reasons,omitempty"` // of failed and skipped items, at most maxSummaryReasons
+	start     time.Time
+}
+
+func newBatchSummary() *batchSummary {
+	return &batchSummary{start: time.Now()}
+}
+
+func (s *batchSummary) succeed() {
+	s.Processed++
+	s.Succeeded++
+}
+
+func (s *batchSummary) fail(reason string) {
+	s.Processed++
+	s.Failed++
+	s.addReason(reason)
+}
+
+func (s *batchSummary) skip(reason string) {
+	s.Processed++
+	s.Skipped++
+	s.addReason(reason)
+}
+
+func (s *batchSummary) addReason(reason string) {
+	if len(s.Reasons) < maxSummaryReasons {
+		s.Reasons = append(s.Reasons, reason)
+	}
+}
+
+// print writes the summary to stdout, as JSON with jsonOut.
+func (s *batchSummary) print(jsonOut bool) {
+	s.Elapsed = time.Since(s.start).Seconds()
+	if jsonOut {
+		json.NewEncoder(os.Stdout).Encode(s)
+		return
+	}
+	fmt.Printf("Summary: %d processed, %d succeeded, %d failed, %d skipped in %.2fs\n",
+		s.Processed, s.Succeeded, s.Failed, s.Skipped, s.Elapsed)
+	for _, r := range s.Reasons {
+		fmt.Println(" ", r)
+	}
+	if more := s.Failed + s.Skipped - len(s.Reasons); more > 0 {
+		fmt.Printf("  ... and %d more\n", more)
+	}
+}
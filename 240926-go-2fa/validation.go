@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// Reason says why a passcode was accepted or refused.
+type Reason int
+
+const (
+	ReasonValid         Reason = iota // matches the current period
+	ReasonClockDrift                  // matches a neighbouring period within the skew, still valid
+	ReasonWrongCode                   // matches nowhere
+	ReasonOutsideWindow               // matches SkewOffset periods away, beyond the skew
+	ReasonRateLimited                 // not checked, too many attempts
+	ReasonLockedOut                   // not checked, the account is locked
+)
+
+var reasonNames = [...]string{"valid", "clock_drift", "wrong_code", "outside_window", "rate_limited", "locked_out"}
+
+func (r Reason) String() string {
+	if int(r) < len(reasonNames) {
+		return reasonNames[r]
+	}
+	return "unknown"
+}
+
+// ValidationResult is the outcome of checking a passcode.
+type ValidationResult struct {
+	Valid  bool
+	Reason Reason
+	// SkewOffset is the period the code matched at relative to now, for
+	// ReasonClockDrift and ReasonOutsideWindow; positive means the
+	// authenticator's clock is ahead.
+	SkewOffset int
+	// Secret is the index of the secret that matched, 1 for the previous
+	// secret during a rotation overlap
+	Secret int
+}
+
+// exitCode maps the result to the exit codes every command uses.
+func (r ValidationResult) exitCode() int {
+	switch {
+	case r.Valid:
+		return exitOK
+	case r.Reason == ReasonRateLimited || r.Reason == ReasonLockedOut:
+		return exitFailure
+	}
+	return exitInvalid
+}
+
+// validateCode checks passcode against secrets at t, accepting opts.Skew
+// periods either side. An invalid code is looked for up to searchSteps
+// periods either side, to tell a wrong code from a wrong clock; 0 skips that.
+func validateCode(passcode string, secrets []string, encoder string, t time.Time, opts totp.ValidateOpts, searchSteps int) ValidationResult {
+	for i, secret := range secrets {
+		step, ok := scanSteps(t, int(opts.Skew), opts.Period, func(at time.Time) bool {
+			return codeMatches(passcode, secret, encoder, at, opts)
+		})
+		if ok {
+			reason := ReasonValid
+			if step != 0 {
+				reason = ReasonClockDrift
+			}
+			return ValidationResult{Valid: true, Reason: reason, SkewOffset: step, Secret: i}
+		}
+	}
+	if searchSteps > int(opts.Skew) {
+		step, ok := scanSteps(t, searchSteps, opts.Period, func(at time.Time) bool {
+			for _, secret := range secrets {
+				if codeMatches(passcode, secret, encoder, at, opts) {
+					return true
+				}
+			}
+			return false
+		})
+		if ok {
+			return ValidationResult{Reason: ReasonOutsideWindow, SkewOffset: step}
+		}
+	}
+	return ValidationResult{Reason: ReasonWrongCode}
+}
+
+// validCode reports whether passcode is valid for secret at t with the
+// default parameters and skew.
+func validCode(passcode, secret, encoder string, t time.Time) bool {
+	return validateCode(passcode, []string{secret}, encoder, t, Account{}.validateOpts(), 0).Valid
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// A vault is the accounts store encrypted with a passphrase, for offline
+// validators that must not keep secrets on disk in the clear. The store JSON
+// is sealed with AES-256-GCM under a key derived from the passphrase with
+// PBKDF2-HMAC-SHA256; a fresh salt and nonce are used on every save.
+const (
+	vaultVersion       = 1
+	vaultKDF           = "pbkdf2-sha256"
+	vaultIterations    = 600000
+	vaultPassphraseEnv = "TOTP_VAULT_PASSPHRASE"
+
+	// A vault file outside these bounds is refused: too few iterations
+	// make the passphrase cheap to guess, and too many would make
+	// unlocking a crafted file hang
+	vaultMinIterations = 100000
+	vaultMaxIterations = 10000000
+)
+
+// vaultFile is the on-disk form of a vault. The byte fields are base64 in
+// the JSON.
+type vaultFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// runVault manages vaults and returns the exit code:
+//
+//	vault seal -store accounts.json -vault accounts.vault
+//	vault list -vault accounts.vault
+func runVault(args []string) int {
+	if len(args) == 0 || (args[0] != "seal" && args[0] != "list") {
+		fmt.Println("usage: vault seal|list [flags]")
+		return exitUsage
+	}
+	fs := flag.NewFlagSet("vault "+args[0], flag.ExitOnError)
+	vaultPath := fs.String("vault", "accounts.vault", "Vault file")
+	passphraseFile := fs.String("passphrase-file", "", "File holding the vault passphrase (default: $"+vaultPassphraseEnv+")")
+	storePath := fs.String("store", "accounts.json", "Plaintext accounts file to seal into the vault")
+	force := fs.Bool("force", false, "Overwrite the vault if it exists")
+	fs.BoolVar(&quiet, "quiet", false, quietUsage)
+	fs.Parse(args[1:])
+
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return exitUsage
+	}
+
+	if args[0] == "list" {
+		store, err := LoadVault(*vaultPath, passphrase)
+		if err != nil {
+			fmt.Println("Error loading vault:", err)
+			return exitFailure
+		}
+		for _, a := range store.Accounts {
+			fmt.Println(a.Name)
+		}
+		return exitOK
+	}
+
+	if _, err := os.Stat(*vaultPath); err == nil && !*force {
+		fmt.Printf("Error: %s already exists (use -force to overwrite it)\n", *vaultPath)
+		return exitFailure
+	}
+	store, err := LoadStore(*storePath)
+	if err != nil {
+		fmt.Println("Error loading store:", err)
+		return exitFailure
+	}
+	if len(store.Accounts) == 0 {
+		fmt.Printf("Error: no accounts in %s\n", *storePath)
+		return exitFailure
+	}
+	store.path, store.passphrase = *vaultPath, passphrase
+	if err := store.Save(); err != nil {
+		fmt.Println("Error writing vault:", err)
+		return exitFailure
+	}
+	infof("Sealed %d accounts into %s\n", len(store.Accounts), *vaultPath)
+	infof("%s still holds the secrets in the clear, delete it once the vault is provisioned\n", *storePath)
+	return exitOK
+}
+
+// readPassphrase reads the vault passphrase from file, or from the
+// environment when file is empty. Only a trailing newline is stripped.
+func readPassphrase(file string) (string, error) {
+	passphrase := os.Getenv(vaultPassphraseEnv)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading passphrase: %w", err)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("no vault passphrase, set %s or use -passphrase-file", vaultPassphraseEnv)
+	}
+	return passphrase, nil
+}
+
+// LoadVault decrypts the vault at path. Saving the returned store encrypts it
+// again with the same passphrase.
+func LoadVault(path, passphrase string) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var v vaultFile
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if v.Version != vaultVersion || v.KDF != vaultKDF {
+		return nil, fmt.Errorf("%s: unsupported vault version %d (%s)", path, v.Version, v.KDF)
+	}
+	if v.Iterations < vaultMinIterations || v.Iterations > vaultMaxIterations {
+		return nil, fmt.Errorf("%s: %d iterations is outside %d-%d", path, v.Iterations, vaultMinIterations, vaultMaxIterations)
+	}
+	aead, err := vaultCipher(passphrase, v.Salt, v.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%s: bad nonce", path)
+	}
+	plain, err := aead.Open(nil, v.Nonce, v.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or damaged vault")
+	}
+	s := &Store{path: path, passphrase: passphrase}
+	if err := json.Unmarshal(plain, s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// sealVault encrypts the store JSON in plain into a vault file.
+func sealVault(plain []byte, passphrase string) ([]byte, error) {
+	v := vaultFile{
+		Version:    vaultVersion,
+		KDF:        vaultKDF,
+		Iterations: vaultIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(v.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := vaultCipher(passphrase, v.Salt, v.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	v.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(v.Nonce); err != nil {
+		return nil, err
+	}
+	v.Ciphertext = aead.Seal(nil, v.Nonce, plain, nil)
+	return json.MarshalIndent(v, "", "  ")
+}
+
+func vaultCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/shafiqsaaidin/go-project/term"
+)
+
+// runWatchAll shows the current code of every stored account, redrawn every
+// second until Ctrl-C, and returns the exit code. Codes with -warn seconds or
+// less left are highlighted. When stdout isn't a terminal the table is
+// printed once.
+func runWatchAll(args []string) int {
+	fs := flag.NewFlagSet("watch-all", flag.ExitOnError)
+	storePath := fs.String("store", "accounts.json", "Accounts file")
+	vaultPath := fs.String("vault", "", "Encrypted vault to read instead of -store")
+	passphraseFile := fs.String("passphrase-file", "", "File holding the vault passphrase (default: $"+vaultPassphraseEnv+")")
+	warn := fs.Uint("warn", 5, "Highlight codes with this many seconds or less left")
+	noColor := fs.Bool("no-color", false, "Don't highlight expiring codes")
+	fs.Parse(args)
+
+	var store *Store
+	var err error
+	if *vaultPath != "" {
+		var passphrase string
+		if passphrase, err = readPassphrase(*passphraseFile); err == nil {
+			store, err = LoadVault(*vaultPath, passphrase)
+		}
+	} else {
+		store, err = LoadStore(*storePath)
+	}
+	if err != nil {
+		fmt.Println("Error loading store:", err)
+		return exitFailure
+	}
+	if len(store.Accounts) == 0 {
+		fmt.Printf("Error: no accounts in %s\n", store.path)
+		return exitFailure
+	}
+
+	scr := term.NewScreen(os.Stdout)
+	defer scr.Close()
+	if !scr.TTY() {
+		scr.Draw(codeTable(store.Accounts, clockNow(), *warn, false))
+		return exitOK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	color := !*noColor && os.Getenv("NO_COLOR") == ""
+	for {
+		now := clockNow()
+		scr.Draw(codeTable(store.Accounts, now, *warn, color))
+		// Wake on the next whole second, when the countdown changes
+		select {
+		case <-ctx.Done():
+			return exitOK
+		case <-time.After(now.Truncate(time.Second).Add(time.Second).Sub(now)):
+		}
+	}
+}
+
+// codeTable formats the accounts' codes at t as aligned lines, with a header.
+// With color the rows of codes about to expire are shown in red.
+func codeTable(accounts []Account, t time.Time, warn uint, color bool) []string {
+	width := len("ACCOUNT")
+	for _, a := range accounts {
+		width = max(width, len(a.Name))
+	}
+	lines := []string{fmt.Sprintf("%-*s  %-8s  %s", width, "ACCOUNT", "CODE", "LEFT")}
+	for _, a := range accounts {
+		opts := a.validateOpts()
+		left := opts.Period - uint(t.Unix())%opts.Period
+		code := "error"
+		if secret, err := normalizeSecret(a.Secret); err == nil {
+			if c, err := totp.GenerateCodeCustom(secret, t, opts); err == nil {
+				code = c
+			}
+		}
+		line := fmt.Sprintf("%-*s  %-8s  %3ds", width, a.Name, code, left)
+		if color && left <= warn {
+			line = "\x1b[31m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -1,3 +1,7 @@
 module github.com/shafiqsaaidin/go-project/240928-go-flag
 
 go 1.22.0
+
+require github.com/shafiqsaaidin/go-project/version v0.0.0
+
+replace github.com/shafiqsaaidin/go-project/version => ../version
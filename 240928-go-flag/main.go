@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+
+	"github.com/shafiqsaaidin/go-project/version"
 )
 
 func main() {
@@ -31,6 +33,8 @@ func main() {
 		fmt.Println("subcommand 'two'")
 		fmt.Println("  tea:", *twoTea)
 		fmt.Println("  tail:", subTwo.Args())
+	case "version", "-version", "--version":
+		version.Print(os.Stdout)
 	default:
 		fmt.Println("expected 'one' or 'two' subcommands")
 		os.Exit(1)
@@ -0,0 +1,3 @@
+module github.com/shafiqsaaidin/go-project/term
+
+go 1.22.0
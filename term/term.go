@@ -0,0 +1,125 @@
+// Package term draws status output in place on a terminal: a single line,
+// such as the download manager's progress bar, or a block of lines, such as
+// the 2FA tool's watch-all table. When the output isn't a terminal, e.g. a
+// pipe or a log file, every update is printed plainly instead, without
+// control characters.
+package term
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// defaultWidth is used when the terminal can't be asked and $COLUMNS isn't
+// set.
+const defaultWidth = 80
+
+// IsTerminal reports whether w is a file attached to an interactive
+// terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Width returns the width of the terminal w is attached to, falling back
+// to $COLUMNS and then 80 columns.
+func Width(w io.Writer) int {
+	if f, ok := w.(*os.File); ok && IsTerminal(f) {
+		if width := terminalWidth(f.Fd()); width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// Line is a line of status output that is redrawn in place on a terminal.
+// Anywhere else every update is printed as a line of its own, so callers
+// should update less often there.
+type Line struct {
+	out   io.Writer
+	tty   bool
+	width int
+}
+
+// NewLine returns a Line writing to out.
+func NewLine(out io.Writer) *Line {
+	return &Line{out: out, tty: IsTerminal(out), width: Width(out)}
+}
+
+// TTY reports whether the line is redrawn in place.
+func (l *Line) TTY() bool { return l.tty }
+
+// Width returns the width of the terminal.
+func (l *Line) Width() int { return l.width }
+
+// Set replaces the line with s.
+func (l *Line) Set(s string) {
+	if !l.tty {
+		fmt.Fprintln(l.out, s)
+		return
+	}
+	// Pad so a shorter line fully covers the previous one
+	fmt.Fprintf(l.out, "\r%-*s", l.width-1, s)
+}
+
+// Done ends the line, so whatever is printed next starts on a fresh one.
+func (l *Line) Done() {
+	if l.tty {
+		fmt.Fprintln(l.out)
+	}
+}
+
+// Screen redraws a block of lines in place on a terminal, with the cursor
+// hidden until Close. Anywhere else each Draw prints the lines once more.
+type Screen struct {
+	out   io.Writer
+	tty   bool
+	lines int // lines drawn last time, to move back up over
+}
+
+// NewScreen returns a Screen writing to out.
+func NewScreen(out io.Writer) *Screen {
+	s := &Screen{out: out, tty: IsTerminal(out)}
+	if s.tty {
+		fmt.Fprint(out, "\x1b[?25l")
+	}
+	return s
+}
+
+// TTY reports whether the screen is redrawn in place.
+func (s *Screen) TTY() bool { return s.tty }
+
+// Draw replaces the previously drawn lines with lines.
+func (s *Screen) Draw(lines []string) {
+	if !s.tty {
+		for _, line := range lines {
+			fmt.Fprintln(s.out, line)
+		}
+		return
+	}
+	if s.lines > 0 {
+		fmt.Fprintf(s.out, "\x1b[%dF", s.lines)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(s.out, "\x1b[2K%s\n", line)
+	}
+	// Clear whatever is left of a longer previous drawing
+	fmt.Fprint(s.out, "\x1b[J")
+	s.lines = len(lines)
+}
+
+// Close leaves the last drawing on screen and restores the cursor.
+func (s *Screen) Close() {
+	if s.tty {
+		fmt.Fprint(s.out, "\x1b[?25h")
+	}
+}
@@ -0,0 +1,112 @@
+package term
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIsTerminal(t *testing.T) {
+	if IsTerminal(&bytes.Buffer{}) {
+		t.Error("a bytes.Buffer is not a terminal")
+	}
+}
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		columns string
+		want    int
+	}{
+		{"", defaultWidth},
+		{"120", 120},
+		{"0", defaultWidth},
+		{"wide", defaultWidth},
+	}
+	for _, tt := range tests {
+		t.Setenv("COLUMNS", tt.columns)
+		if got := Width(&bytes.Buffer{}); got != tt.want {
+			t.Errorf("COLUMNS=%q: Width = %d, want %d", tt.columns, got, tt.want)
+		}
+	}
+}
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		name string
+		tty  bool
+		want string
+	}{
+		{"terminal", true, "\rfirst update\rsecond      \n"},
+		{"pipe", false, "first update\nsecond\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &Line{out: &out, tty: tt.tty, width: 13}
+			l.Set("first update")
+			l.Set("second")
+			l.Done()
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLineOnPipe(t *testing.T) {
+	var out bytes.Buffer
+	l := NewLine(&out)
+	if l.TTY() {
+		t.Fatal("NewLine on a buffer must not redraw in place")
+	}
+	l.Set("50%")
+	l.Done()
+	if out.String() != "50%\n" {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestScreen(t *testing.T) {
+	tests := []struct {
+		name string
+		tty  bool
+		want string
+	}{
+		{
+			"terminal", true,
+			"\x1b[?25l" +
+				"\x1b[2Ka\n\x1b[2Kb\n\x1b[J" +
+				"\x1b[2F\x1b[2Kc\n\x1b[J" +
+				"\x1b[?25h",
+		},
+		{"pipe", false, "a\nb\nc\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			s := &Screen{out: &out, tty: tt.tty}
+			if tt.tty {
+				// What NewScreen does on a terminal
+				out.WriteString("\x1b[?25l")
+			}
+			s.Draw([]string{"a", "b"})
+			s.Draw([]string{"c"})
+			s.Close()
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewScreenOnPipe(t *testing.T) {
+	var out bytes.Buffer
+	s := NewScreen(&out)
+	if s.TTY() {
+		t.Fatal("NewScreen on a buffer must not redraw in place")
+	}
+	s.Draw([]string{"x"})
+	s.Close()
+	if out.String() != "x\n" {
+		t.Errorf("got %q, want no control characters", out.String())
+	}
+}
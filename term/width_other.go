@@ -0,0 +1,9 @@
+//go:build !(linux || darwin)
+
+package term
+
+// terminalWidth can't ask the terminal on this platform; COLUMNS or the
+// default width is used instead.
+func terminalWidth(fd uintptr) int {
+	return 0
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package term
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth returns the width of the terminal on fd, or 0 if it isn't one.
+func terminalWidth(fd uintptr) int {
+	var ws struct{ rows, cols, x, y uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.cols)
+}
@@ -0,0 +1,38 @@
+// Package version reports which build of a tool is running. All three tools
+// print it the same way, for their version subcommand and -version flag.
+package version
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/shafiqsaaidin/go-project/version.Version=1.2.0 -X github.com/shafiqsaaidin/go-project/version.Commit=$(git rev-parse --short HEAD) -X github.com/shafiqsaaidin/go-project/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Print writes the version, commit and build date. Without -ldflags the
+// commit comes from the VCS info Go embeds, when there is any.
+func Print(w io.Writer) {
+	c, d := Commit, Date
+	if info, ok := debug.ReadBuildInfo(); ok && c == "" {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				c = s.Value
+			}
+		}
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	fmt.Fprintf(w, "%s (commit %s, built %s)\n", Version, c, d)
+}
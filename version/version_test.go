@@ -0,0 +1,28 @@
+package version
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrint(t *testing.T) {
+	saved := [3]string{Version, Commit, Date}
+	defer func() { Version, Commit, Date = saved[0], saved[1], saved[2] }()
+
+	tests := []struct {
+		version, commit, date string
+		want                  string
+	}{
+		{"1.2.0", "abc123", "2024-10-01", "1.2.0 (commit abc123, built 2024-10-01)\n"},
+		// A test binary has no VCS info to fall back on
+		{"dev", "", "", "dev (commit unknown, built unknown)\n"},
+	}
+	for _, tt := range tests {
+		Version, Commit, Date = tt.version, tt.commit, tt.date
+		var out bytes.Buffer
+		Print(&out)
+		if out.String() != tt.want {
+			t.Errorf("Print() = %q, want %q", out.String(), tt.want)
+		}
+	}
+}